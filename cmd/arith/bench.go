@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/helpers"
+	"github.com/cravtos/arithmetic/internal/pkg/timing"
+)
+
+// compressor is a configuration measured by bench command.
+// If timed is set, time spent in phases of coding is added to t given to encode and decode, unless t is nil.
+type compressor struct {
+	name   string
+	timed  bool
+	encode func(w io.Writer, data []byte, t *timing.Timings) error
+	decode func(r io.Reader, w io.Writer, t *timing.Timings) error
+}
+
+// benchPhases holds time spent in phases of coding, measured with -v
+type benchPhases struct {
+	IO       time.Duration `json:"io_ns"`
+	Modeling time.Duration `json:"modeling_ns"`
+	Coding   time.Duration `json:"coding_ns"`
+	Other    time.Duration `json:"other_ns"`
+}
+
+// benchResult holds measurements of one compressor on one file, or on all files in totals
+type benchResult struct {
+	File         string  `json:"file,omitempty"`
+	Compressor   string  `json:"compressor"`
+	Size         int64   `json:"size"`
+	Compressed   int64   `json:"compressed"`
+	Ratio        float64 `json:"ratio"`
+	BitsPerByte  float64 `json:"bits_per_byte"`
+	EncodeMBps   float64 `json:"encode_mb_per_s"`
+	DecodeMBps   float64 `json:"decode_mb_per_s"`
+	EncodeMemory uint64  `json:"encode_peak_memory"`
+	DecodeMemory uint64  `json:"decode_peak_memory"`
+
+	EncodePhases *benchPhases `json:"encode_phases,omitempty"`
+	DecodePhases *benchPhases `json:"decode_phases,omitempty"`
+
+	encodeTime time.Duration
+	decodeTime time.Duration
+}
+
+// benchReport is written by bench command with -json flag
+type benchReport struct {
+	GoVersion string        `json:"go_version"`
+	Results   []benchResult `json:"results"`
+	Totals    []benchResult `json:"totals"`
+}
+
+func bench(args []string) (ok bool) {
+	fs := newFlagSet("bench", "dir|file ...")
+	models := fs.String("models", "all", "Comma separated models to measure, or all.")
+	baselines := fs.Bool("baselines", true, "Measure gzip, flate, zlib and lzw from standard library.")
+	blockSize := fs.Uint64("block-size", 0, "Size of independently coded blocks in bytes, 0 codes files as a single block.")
+	workers := fs.Int("workers", 0, "Number of blocks coded in parallel, 0 uses all CPUs.")
+	asJSON := fs.Bool("json", false, "Print results as JSON instead of table.")
+	verbose := fs.Bool("v", false, "Print time spent in reading and writing, modeling and coding.")
+	startProfile := helpers.ProfileFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return false
+	}
+	prof, err := startProfile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+	defer func() {
+		if err := prof.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+			ok = false
+		}
+	}()
+
+	compressors, err := benchCompressors(*models, *baselines, *blockSize, *workers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+	files, err := corpus(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+
+	report := benchReport{GoVersion: runtime.Version()}
+	totals := make([]benchResult, len(compressors))
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+			return false
+		}
+		for i, c := range compressors {
+			res, err := measureCompressor(c, data, *verbose)
+			if err != nil {
+				warn(path, fmt.Errorf("%s: %v", c.name, err))
+				return false
+			}
+			res.File = path
+			report.Results = append(report.Results, res)
+			totals[i].add(res)
+		}
+	}
+	for i, c := range compressors {
+		totals[i].Compressor = c.name
+		totals[i].summarize()
+	}
+	report.Totals = totals
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+			return false
+		}
+		return true
+	}
+	if err := printReport(report, *verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// benchCompressors returns compressors selected by flags of bench command
+func benchCompressors(models string, baselines bool, blockSize uint64, workers int) ([]compressor, error) {
+	var kinds []config.ModelKind
+	if models == "all" {
+		for k := config.ModelAdaptive; k.Known(); k++ {
+			kinds = append(kinds, k)
+		}
+	} else {
+		for _, name := range strings.Split(models, ",") {
+			k, err := config.ParseModelKind(strings.TrimSpace(name))
+			if err != nil {
+				return nil, err
+			}
+			kinds = append(kinds, k)
+		}
+	}
+
+	var compressors []compressor
+	for _, k := range kinds {
+		opts := config.Default()
+		opts.ModelKind = k
+		opts.BlockSize = blockSize
+		opts.Workers = workers
+		if err := opts.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid coder parameters: %v", err)
+		}
+		compressors = append(compressors, arithCompressor(opts))
+	}
+	if baselines {
+		compressors = append(compressors, baselineCompressors()...)
+	}
+	return compressors, nil
+}
+
+// arithCompressor returns compressor coding data with opts
+func arithCompressor(opts config.Options) compressor {
+	name := "arith-" + opts.ModelKind.String()
+	if opts.BlockSize != 0 {
+		name += fmt.Sprintf("-%d", opts.BlockSize)
+	}
+
+	// Decoding is benchmarked without limits, since data is known
+	decodeOpts := config.Default()
+	decodeOpts.Workers = opts.Workers
+
+	return compressor{
+		name:  name,
+		timed: true,
+		encode: func(w io.Writer, data []byte, t *timing.Timings) error {
+			opts := opts
+			opts.Timings = t
+			return arithmetic.Encode(bytes.NewReader(data), w, opts)
+		},
+		decode: func(r io.Reader, w io.Writer, t *timing.Timings) error {
+			opts := decodeOpts
+			opts.Timings = t
+			return arithmetic.Decode(r, w, opts)
+		},
+	}
+}
+
+// baselineCompressors returns compressors of standard library with default settings
+func baselineCompressors() []compressor {
+	return []compressor{
+		streamCompressor("gzip",
+			func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+			func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }),
+		streamCompressor("flate",
+			func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.DefaultCompression) },
+			func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil }),
+		streamCompressor("zlib",
+			func(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriter(w), nil },
+			func(r io.Reader) (io.ReadCloser, error) { return zlib.NewReader(r) }),
+		streamCompressor("lzw",
+			func(w io.Writer) (io.WriteCloser, error) { return lzw.NewWriter(w, lzw.LSB, 8), nil },
+			func(r io.Reader) (io.ReadCloser, error) { return lzw.NewReader(r, lzw.LSB, 8), nil }),
+	}
+}
+
+// streamCompressor returns compressor of writer and reader constructors like compress/gzip ones
+func streamCompressor(name string,
+	newWriter func(io.Writer) (io.WriteCloser, error), newReader func(io.Reader) (io.ReadCloser, error)) compressor {
+	return compressor{
+		name: name,
+		encode: func(w io.Writer, data []byte, _ *timing.Timings) error {
+			zw, err := newWriter(w)
+			if err != nil {
+				return err
+			}
+			if _, err := zw.Write(data); err != nil {
+				return err
+			}
+			return zw.Close()
+		},
+		decode: func(r io.Reader, w io.Writer, _ *timing.Timings) error {
+			zr, err := newReader(r)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(w, zr); err != nil {
+				return err
+			}
+			return zr.Close()
+		},
+	}
+}
+
+// corpus returns regular files found in given files and directories
+func corpus(paths []string) ([]string, error) {
+	var files []string
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no files to benchmark")
+	}
+	return files, nil
+}
+
+// measureCompressor encodes and decodes data with c, and checks that it is decoded back unchanged.
+// If verbose is set, time spent in phases of coding is measured too, if c supports it.
+func measureCompressor(c compressor, data []byte, verbose bool) (benchResult, error) {
+	res := benchResult{Compressor: c.name, Size: int64(len(data))}
+	var encodeTimings, decodeTimings *timing.Timings
+	if verbose && c.timed {
+		encodeTimings, decodeTimings = &timing.Timings{}, &timing.Timings{}
+	}
+
+	enc := &bytes.Buffer{}
+	var err error
+	res.encodeTime, res.EncodeMemory, err = measure(func() error {
+		return c.encode(enc, data, encodeTimings)
+	})
+	if err != nil {
+		return res, fmt.Errorf("got error while encoding: %v", err)
+	}
+	res.Compressed = int64(enc.Len())
+
+	dec := &bytes.Buffer{}
+	res.decodeTime, res.DecodeMemory, err = measure(func() error {
+		return c.decode(bytes.NewReader(enc.Bytes()), dec, decodeTimings)
+	})
+	if err != nil {
+		return res, fmt.Errorf("got error while decoding: %v", err)
+	}
+	if !bytes.Equal(data, dec.Bytes()) {
+		return res, errors.New("original and decoded data are not equal")
+	}
+	if encodeTimings != nil {
+		res.EncodePhases = newBenchPhases(encodeTimings, res.encodeTime)
+		res.DecodePhases = newBenchPhases(decodeTimings, res.decodeTime)
+	}
+
+	res.summarize()
+	return res, nil
+}
+
+// newBenchPhases returns time spent in phases of coding measured by t, out of total time
+func newBenchPhases(t *timing.Timings, total time.Duration) *benchPhases {
+	p := &benchPhases{IO: t.IO(), Modeling: t.Modeling(), Coding: t.Coding()}
+	p.Other = total - p.IO - p.Modeling - p.Coding
+	if p.Other < 0 {
+		// Blocks coded in parallel take more time, than passes
+		p.Other = 0
+	}
+	return p
+}
+
+// add accumulates time spent in phases of coding of r in total
+func (total *benchPhases) add(r *benchPhases) {
+	total.IO += r.IO
+	total.Modeling += r.Modeling
+	total.Coding += r.Coding
+	total.Other += r.Other
+}
+
+// add accumulates sizes, times and peak memory of r in total
+func (total *benchResult) add(r benchResult) {
+	if r.EncodePhases != nil {
+		if total.EncodePhases == nil {
+			total.EncodePhases, total.DecodePhases = &benchPhases{}, &benchPhases{}
+		}
+		total.EncodePhases.add(r.EncodePhases)
+		total.DecodePhases.add(r.DecodePhases)
+	}
+	total.Size += r.Size
+	total.Compressed += r.Compressed
+	total.encodeTime += r.encodeTime
+	total.decodeTime += r.decodeTime
+	if r.EncodeMemory > total.EncodeMemory {
+		total.EncodeMemory = r.EncodeMemory
+	}
+	if r.DecodeMemory > total.DecodeMemory {
+		total.DecodeMemory = r.DecodeMemory
+	}
+}
+
+// summarize computes ratio, bits per byte and speeds from sizes and times
+func (r *benchResult) summarize() {
+	if r.Compressed > 0 {
+		r.Ratio = float64(r.Size) / float64(r.Compressed)
+	}
+	if r.Size > 0 {
+		r.BitsPerByte = float64(r.Compressed) * 8 / float64(r.Size)
+	}
+	r.EncodeMBps = megabytesPerSecond(r.Size, r.encodeTime)
+	r.DecodeMBps = megabytesPerSecond(r.Size, r.decodeTime)
+}
+
+func megabytesPerSecond(size int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(size) / 1e6 / d.Seconds()
+}
+
+// measure runs f, and returns its duration and growth of heap obtained from system.
+// Memory statistics are read only before and after f, so the world isn't stopped while it is timed.
+// Heap isn't returned to system right after it is freed, so its growth is close to peak memory used by f.
+func measure(f func() error) (time.Duration, uint64, error) {
+	debug.FreeOSMemory()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	err := f()
+	elapsed := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+	var grown uint64
+	if used, base := after.HeapSys-after.HeapReleased, before.HeapSys-before.HeapReleased; used > base {
+		grown = used - base
+	}
+	return elapsed, grown, err
+}
+
+// printReport prints results and totals as table.
+// If verbose is set, it is followed by table of time spent in phases of coding.
+func printReport(report benchReport, verbose bool) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "file\tcompressor\tsize\tcompressed\tratio\tbpb\tencode MB/s\tdecode MB/s\tencode mem\tdecode mem")
+	for _, r := range report.Results {
+		printResult(tw, r.File, r)
+	}
+	for _, r := range report.Totals {
+		printResult(tw, "total", r)
+	}
+	if err := tw.Flush(); err != nil || !verbose {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Fprintln(tw, "file\tcompressor\tpass\tio\tmodeling\tcoding\tother")
+	for _, r := range report.Results {
+		printPhases(tw, r.File, r)
+	}
+	for _, r := range report.Totals {
+		printPhases(tw, "total", r)
+	}
+	return tw.Flush()
+}
+
+// printPhases prints time spent in phases of encoding and decoding, if it is measured
+func printPhases(w io.Writer, file string, r benchResult) {
+	if r.EncodePhases == nil {
+		return
+	}
+	for _, pass := range []struct {
+		name   string
+		phases *benchPhases
+	}{{"encode", r.EncodePhases}, {"decode", r.DecodePhases}} {
+		p := pass.phases
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%v\t%v\t%v\n", file, r.Compressor, pass.name,
+			p.IO.Round(time.Microsecond), p.Modeling.Round(time.Microsecond),
+			p.Coding.Round(time.Microsecond), p.Other.Round(time.Microsecond))
+	}
+}
+
+func printResult(w io.Writer, file string, r benchResult) {
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.3f\t%.3f\t%.2f\t%.2f\t%s\t%s\n", file, r.Compressor, r.Size, r.Compressed,
+		r.Ratio, r.BitsPerByte, r.EncodeMBps, r.DecodeMBps, formatBytes(r.EncodeMemory), formatBytes(r.DecodeMemory))
+}
+
+// formatBytes returns n in binary units
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[exp])
+}
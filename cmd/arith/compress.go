@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/helpers"
+)
+
+// compressFlags holds flags of compress command
+type compressFlags struct {
+	keep   bool
+	force  bool
+	stdout bool
+	noName bool
+}
+
+func compress(args []string) bool {
+	fs := newFlagSet("compress", "[file ...]")
+	var f compressFlags
+	fs.BoolVar(&f.keep, "k", false, "Keep input files.")
+	fs.BoolVar(&f.force, "f", false, "Overwrite existing output files, and write compressed data to terminal.")
+	fs.BoolVar(&f.stdout, "c", false, "Write to standard output and keep input files.")
+	fs.BoolVar(&f.noName, "n", false, "Don't store name, modification time and permissions of input files.")
+	_, instrument := instrumentFlags(fs, "Print time spent in reading and writing, modeling and coding.")
+	coderOptions := helpers.EncodeFlags(fs)
+	fs.Parse(args)
+
+	opts, err := coderOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+	if f.stdout && fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "arith: -c takes a single file, since stream holds one file")
+		return false
+	}
+	finish, err := instrument(&opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+
+	ok := true
+	for _, path := range inputs(fs) {
+		if err := compressFile(path, opts, f); err != nil {
+			warn(displayName(path), err)
+			ok = false
+		}
+	}
+	return finish() && ok
+}
+
+// compressFile compresses file at path to path with suffix, or to standard output
+func compressFile(path string, opts config.Options, f compressFlags) error {
+	if helpers.IsStdio(path) || f.stdout {
+		if !f.force && helpers.IsTerminal(os.Stdout) {
+			return errors.New("refusing to write compressed data to terminal, use -f to force")
+		}
+		in, err := helpers.OpenInput(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		if f.noName || helpers.IsStdio(path) {
+			return arithmetic.Encode(in, os.Stdout, opts)
+		}
+		return arithmetic.EncodeFile(in, os.Stdout, opts)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !stat.Mode().IsRegular() {
+		return errors.New("not a regular file, ignored")
+	}
+	if strings.HasSuffix(path, suffix) {
+		return fmt.Errorf("already has %s suffix, ignored", suffix)
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	outPath := path + suffix
+	out, err := helpers.CreateFile(outPath, stat.Mode().Perm(), f.force)
+	if err != nil {
+		return err
+	}
+	if f.noName {
+		err = arithmetic.Encode(in, out, opts)
+	} else {
+		err = arithmetic.EncodeFile(in, out, opts)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(outPath, stat.ModTime(), stat.ModTime())
+	}
+	if err != nil {
+		// Do not leave partially compressed data
+		os.Remove(outPath)
+		return err
+	}
+
+	if f.keep {
+		return nil
+	}
+	in.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/helpers"
+)
+
+// decompressFlags holds flags of decompress command
+type decompressFlags struct {
+	keep    bool
+	force   bool
+	stdout  bool
+	useName bool
+}
+
+func decompress(args []string) bool {
+	fs := newFlagSet("decompress", "[file ...]")
+	var f decompressFlags
+	fs.BoolVar(&f.keep, "k", false, "Keep input files.")
+	fs.BoolVar(&f.force, "f", false, "Overwrite existing output files.")
+	fs.BoolVar(&f.stdout, "c", false, "Write to standard output and keep input files.")
+	fs.BoolVar(&f.useName, "N", false, "Name output files by original names stored in input files, and restore their stored permissions and mtimes.")
+	_, instrument := instrumentFlags(fs, "Print time spent in reading and writing, modeling and coding.")
+	decoderOptions := helpers.DecodeFlags(fs)
+	fs.Parse(args)
+
+	opts, err := decoderOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+	finish, err := instrument(&opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+
+	ok := true
+	for _, path := range inputs(fs) {
+		if err := decompressFile(path, opts, f); err != nil {
+			warn(displayName(path), err)
+			ok = false
+		}
+	}
+	return finish() && ok
+}
+
+// decompressFile decompresses file at path to path without suffix, or to standard output
+func decompressFile(path string, opts config.Options, f decompressFlags) error {
+	if (helpers.IsStdio(path) && !f.useName) || f.stdout {
+		return catFile(path, os.Stdout, opts)
+	}
+
+	if !helpers.IsStdio(path) {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !stat.Mode().IsRegular() {
+			return errors.New("not a regular file, ignored")
+		}
+		if !strings.HasSuffix(path, suffix) && !f.useName {
+			return fmt.Errorf("doesn't have %s suffix, ignored", suffix)
+		}
+	}
+
+	in, r, err := openReader(path, opts)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	meta := r.Meta()
+	outPath := strings.TrimSuffix(path, suffix)
+	if f.useName && (meta.Name != "" || outPath == path) {
+		if outPath, err = helpers.StoredPath(path, meta.Name); err != nil {
+			return err
+		}
+	}
+	out, err := helpers.CreateDecoded(path, outPath, f.force)
+	if err != nil {
+		return err
+	}
+	err = decode(r, out)
+	if err == nil && f.useName {
+		err = helpers.RestoreMeta(out, meta)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Do not leave partially decoded data
+		os.Remove(outPath)
+		return err
+	}
+
+	if f.keep || helpers.IsStdio(path) {
+		return nil
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+func test(args []string) bool {
+	fs := newFlagSet("test", "[file ...]")
+	verbose, instrument := instrumentFlags(fs, "Print names of intact files, and time spent in reading, modeling and coding.")
+	decoderOptions := helpers.DecodeFlags(fs)
+	fs.Parse(args)
+
+	opts, err := decoderOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+	finish, err := instrument(&opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+
+	ok := true
+	for _, path := range inputs(fs) {
+		if err := catFile(path, io.Discard, opts); err != nil {
+			warn(displayName(path), err)
+			ok = false
+		} else if *verbose {
+			fmt.Printf("%s: OK\n", displayName(path))
+		}
+	}
+	return finish() && ok
+}
+
+func cat(args []string) bool {
+	fs := newFlagSet("cat", "[file ...]")
+	_, instrument := instrumentFlags(fs, "Print time spent in reading and writing, modeling and coding.")
+	decoderOptions := helpers.DecodeFlags(fs)
+	fs.Parse(args)
+
+	opts, err := decoderOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+	finish, err := instrument(&opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+		return false
+	}
+
+	ok := true
+	for _, path := range inputs(fs) {
+		if err := catFile(path, os.Stdout, opts); err != nil {
+			warn(displayName(path), err)
+			ok = false
+		}
+	}
+	return finish() && ok
+}
+
+// catFile writes data decompressed from file at path, or standard input, to out
+func catFile(path string, out io.Writer, opts config.Options) error {
+	in, r, err := openReader(path, opts)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return decode(r, out)
+}
+
+// openReader opens file at path, or standard input, and reads header of compressed stream from it
+func openReader(path string, opts config.Options) (*os.File, *arithmetic.Reader, error) {
+	in, err := helpers.OpenInput(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := arithmetic.NewReader(in, opts)
+	if err != nil {
+		in.Close()
+		return nil, nil, err
+	}
+	return in, r, nil
+}
+
+// decode writes data decoded by r to out
+func decode(r *arithmetic.Reader, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	if _, err := io.Copy(w, r); err != nil {
+		if errors.Is(err, arithmetic.ErrLimit) {
+			return fmt.Errorf("%w, use -max-output and -max-ratio to change limits", err)
+		}
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/helpers"
+)
+
+func info(args []string) bool {
+	fs := newFlagSet("info", "[file ...]")
+	fs.Parse(args)
+
+	ok := true
+	for _, path := range inputs(fs) {
+		if err := printInfo(path); err != nil {
+			warn(displayName(path), err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// printInfo prints header of compressed file at path, or standard input
+func printInfo(path string) error {
+	in, err := helpers.OpenInput(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	i, err := arithmetic.ReadInfo(in)
+	if err != nil {
+		return err
+	}
+
+	// Size of seekable stream is found out from its index
+	compressed := int64(-1)
+	if stat, err := in.Stat(); err == nil && stat.Mode().IsRegular() {
+		compressed = stat.Size()
+		if i.Options.Seekable && !i.Custom {
+			if s, err := arithmetic.NewSeekableReader(in, compressed, config.Default()); err == nil {
+				i.Size = s.Size()
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s:\n", displayName(path))
+	fmt.Fprintf(tw, "  version\t%d\n", i.Version)
+
+	o := i.Options
+	switch {
+	case i.Custom:
+		fmt.Fprintf(tw, "  model\tcustom\n")
+	case o.ModelKind == config.ModelPPM:
+		fmt.Fprintf(tw, "  model\t%v, order %d, memory %d MiB\n", o.ModelKind, o.PPMOrder, o.PPMMemory)
+	default:
+		fmt.Fprintf(tw, "  model\t%v\n", o.ModelKind)
+	}
+	fmt.Fprintf(tw, "  interval bits\t%d\n", o.IntervalBitsUsed)
+	fmt.Fprintf(tw, "  count bits\t%d\n", o.CountBitsUsed)
+	fmt.Fprintf(tw, "  count denominator\t%d\n", o.CountDenominator)
+	fmt.Fprintf(tw, "  update rate\t%d\n", o.UpdateRangesRate)
+	if o.BlockSize != 0 {
+		seekable := ""
+		if o.Seekable {
+			seekable = ", seekable"
+		}
+		fmt.Fprintf(tw, "  block size\t%d%s\n", o.BlockSize, seekable)
+	}
+	if i.Stored {
+		fmt.Fprintf(tw, "  stored\tyes\n")
+	}
+	if i.Checksum {
+		fmt.Fprintf(tw, "  checksum\tCRC-32C\n")
+	} else {
+		fmt.Fprintf(tw, "  checksum\tnone\n")
+	}
+
+	if i.Meta.Name != "" {
+		fmt.Fprintf(tw, "  name\t%s\n", i.Meta.Name)
+	}
+	if !i.Meta.ModTime.IsZero() {
+		fmt.Fprintf(tw, "  modified\t%s\n", i.Meta.ModTime.Format(time.RFC3339))
+	}
+	if i.Meta.Mode != 0 {
+		fmt.Fprintf(tw, "  mode\t%v\n", i.Meta.Mode)
+	}
+
+	if i.Size >= 0 {
+		fmt.Fprintf(tw, "  original size\t%d\n", i.Size)
+	} else {
+		fmt.Fprintf(tw, "  original size\tunknown\n")
+	}
+	if compressed >= 0 {
+		fmt.Fprintf(tw, "  compressed size\t%d\n", compressed)
+	}
+	if i.Size > 0 && compressed > 0 {
+		fmt.Fprintf(tw, "  ratio\t%.3f\n", float64(i.Size)/float64(compressed))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,131 @@
+// Command arith compresses and decompresses files with arithmetic coding, following gzip conventions.
+//
+// Usage:
+//
+//	arith compress [flags] [file ...]    compress files to file.ari, standard input to standard output
+//	arith decompress [flags] [file ...]  decompress file.ari to file, standard input to standard output
+//	arith test [flags] [file ...]        check that files decompress without errors
+//	arith info [file ...]                print headers of compressed files
+//	arith cat [flags] [file ...]         decompress files to standard output
+//	arith bench [flags] dir|file ...     compare models and standard library compressors on corpus
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/helpers"
+	"github.com/cravtos/arithmetic/internal/pkg/timing"
+)
+
+// suffix is appended to names of compressed files
+const suffix = ".ari"
+
+// command is a subcommand of arith. It returns false if it failed on any of the files.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) bool
+}
+
+var commands = []command{
+	{"compress", "compress files, replacing them with ones with " + suffix + " suffix", compress},
+	{"decompress", "decompress files, stripping " + suffix + " suffix", decompress},
+	{"test", "check that compressed files are intact", test},
+	{"info", "print coder parameters and original file information of compressed files", info},
+	{"cat", "decompress files to standard output", cat},
+	{"bench", "measure compression ratio, speed and memory of models and standard library compressors", bench},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: arith command [flags] [file ...]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-11s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nWithout files, standard input is read, except by bench. Run arith command -h for its flags.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if !c.run(os.Args[2:]) {
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	if os.Args[1] != "-h" && os.Args[1] != "-help" && os.Args[1] != "help" {
+		fmt.Fprintf(os.Stderr, "arith: unknown command %q\n", os.Args[1])
+	}
+	usage()
+	os.Exit(2)
+}
+
+// newFlagSet returns flag set of command, which exits on errors
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet("arith "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: arith %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// warn prints message about failure on file
+func warn(name string, err error) {
+	fmt.Fprintf(os.Stderr, "arith: %s: %v\n", name, err)
+}
+
+// displayName returns name of file to show in messages
+func displayName(path string) string {
+	if path == "-" {
+		return "stdin"
+	}
+	return path
+}
+
+// inputs returns files given as arguments, or standard input if there are none
+func inputs(fs *flag.FlagSet) []string {
+	if fs.NArg() == 0 {
+		return []string{"-"}
+	}
+	return fs.Args()
+}
+
+// instrumentFlags defines -v flag with usage and flags of profiling in fs.
+// Returned function starts profiling after fs is parsed, and sets Timings of opts if -v is given.
+// Function it returns has to be called at end of command. It prints timings, and returns false if profile wasn't written.
+func instrumentFlags(fs *flag.FlagSet, usage string) (*bool, func(opts *config.Options) (func() bool, error)) {
+	verbose := fs.Bool("v", false, usage)
+	startProfile := helpers.ProfileFlags(fs)
+
+	return verbose, func(opts *config.Options) (func() bool, error) {
+		prof, err := startProfile()
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		if *verbose {
+			opts.Timings = &timing.Timings{}
+		}
+		return func() bool {
+			if opts.Timings != nil {
+				helpers.PrintTimings(os.Stderr, opts.Timings, time.Since(start))
+			}
+			if err := prof.Stop(); err != nil {
+				fmt.Fprintf(os.Stderr, "arith: %v\n", err)
+				return false
+			}
+			return true
+		}, nil
+	}
+}
@@ -1,54 +1,164 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"time"
 
+	"github.com/cravtos/arithmetic/internal/pkg/archive"
 	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
 	"github.com/cravtos/arithmetic/internal/pkg/helpers"
+	"github.com/cravtos/arithmetic/internal/pkg/timing"
 )
 
 func main() {
-	inPath := flag.String("input", "", "File to encode.")
-	outPath := flag.String("output", "", "Output file.")
+	inPath := flag.String("input", "", "File to decode, standard input if omitted or -.")
+	outPath := flag.String("output", "", "Output file, standard output if omitted or -.")
 	printRatio := flag.Bool("pr", false, "Print compression ratio.")
+	list := flag.Bool("list", false, "List entries of archive instead of decoding.")
+	extractDir := flag.String("extract", "", "Extract entries of archive into directory instead of decoding.")
+	useName := flag.Bool("N", false, "Name output file by original name stored in input, if output is not given, and restore its stored permissions and mtime.")
+	force := flag.Bool("f", false, "Overwrite existing file named by original name, or files extracted from archive.")
+	verbose := flag.Bool("v", false, "Print time spent in reading and writing, modeling and coding.")
+
+	decoderOptions := helpers.DecodeFlags(flag.CommandLine)
+	startProfile := helpers.ProfileFlags(flag.CommandLine)
 
 	flag.Parse()
 
-	// Check if file is specified as argument
-	if *inPath == "" || *outPath == "" {
-		fmt.Fprintln(os.Stderr, "specify both input and output files path!")
-		flag.Usage()
+	opts, err := decoderOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	prof, err := startProfile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
+	// os.Exit skips deferred calls, so prof.Exit is used after profiling is started
+	defer func() {
+		if err := prof.Stop(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}()
+
+	start := time.Now()
+	if *verbose {
+		opts.Timings = &timing.Timings{}
+		defer func() {
+			helpers.PrintTimings(os.Stderr, opts.Timings, time.Since(start))
+		}()
+	}
+
+	if *list || *extractDir != "" {
+		if err := readArchive(*inPath, *list, *extractDir, *force, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "got error while reading archive: %v\n", err)
+			prof.Exit(1)
+		}
+		return
+	}
+
+	// Ratio is found out from sizes of files
+	if *printRatio && (helpers.IsStdio(*inPath) || (helpers.IsStdio(*outPath) && !*useName)) {
+		fmt.Fprintln(os.Stderr, "specify both input and output files path to print compression ratio!")
+		prof.Exit(1)
+	}
 
 	// Open file to read data
-	inFile, err := os.Open(*inPath)
+	inFile, err := helpers.OpenInput(*inPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "can't open file %s\n", *inPath)
-		os.Exit(1)
+		prof.Exit(1)
 	}
 	defer inFile.Close()
 
-	// Open file to write decompressed data
-	outFile, err := os.Create(*outPath)
+	r, err := arithmetic.NewReader(inFile, opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "can't create file %s\n", *outPath)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "got error while decoding: %v\n", err)
+		prof.Exit(1)
+	}
+	meta := r.Meta()
+
+	// Open file to write decompressed data. Name stored in input mustn't overwrite existing files
+	var outFile *os.File
+	if *useName && *outPath == "" {
+		if *outPath, err = helpers.StoredPath(*inPath, meta.Name); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			prof.Exit(1)
+		}
+		outFile, err = helpers.CreateDecoded(*inPath, *outPath, *force)
+	} else if !helpers.IsStdio(*outPath) {
+		outFile, err = helpers.CreateDecoded(*inPath, *outPath, true)
+	} else {
+		outFile = os.Stdout
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't create file %s: %v\n", *outPath, err)
+		prof.Exit(1)
 	}
 	defer outFile.Close()
 
-	err = arithmetic.Decode(inFile, outFile)
+	var out io.Writer = outFile
+	if opts.Timings != nil {
+		out = timing.Writer(outFile, opts.Timings)
+	}
+	err = decode(r, out)
+	if err == nil && *useName && !helpers.IsStdio(*outPath) {
+		err = helpers.RestoreMeta(outFile, meta)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "got error while decoding: %v\n", err)
-		os.Exit(1)
+		if errors.Is(err, arithmetic.ErrLimit) {
+			fmt.Fprintln(os.Stderr, "use -max-output and -max-ratio to change limits")
+		}
+
+		// Do not leave partially decoded data
+		if !helpers.IsStdio(*outPath) {
+			outFile.Close()
+			os.Remove(*outPath)
+		}
+		prof.Exit(1)
 	}
 
 	if *printRatio == true {
 		if err := helpers.PrintRatio(inFile, outFile); err != nil {
 			fmt.Fprintf(os.Stderr, "got error while getting compression ratio: %v\n", err)
-			os.Exit(2)
+			prof.Exit(2)
 		}
 	}
 }
+
+// decode writes data decoded by r to out
+func decode(r *arithmetic.Reader, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// readArchive lists entries of archive at path, or extracts them into dir, overwriting existing files if force is set
+func readArchive(path string, list bool, dir string, force bool, opts config.Options) error {
+	inFile, err := helpers.OpenInput(path)
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	if !list {
+		return archive.Extract(inFile, dir, opts, force)
+	}
+
+	entries, err := archive.List(inFile, opts)
+	for _, e := range entries {
+		fmt.Printf("%v %10d %s %s\n", e.Mode, e.Size, e.ModTime.Format("2006-01-02 15:04"), e.Path)
+	}
+	return err
+}
@@ -4,51 +4,136 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/cravtos/arithmetic/internal/pkg/archive"
 	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
 	"github.com/cravtos/arithmetic/internal/pkg/helpers"
+	"github.com/cravtos/arithmetic/internal/pkg/timing"
 )
 
 func main() {
-	inPath := flag.String("input", "", "File to encode.")
-	outPath := flag.String("output", "", "Output file.")
+	inPath := flag.String("input", "", "File to encode, standard input if omitted or -.")
+	outPath := flag.String("output", "", "Output file, standard output if omitted or -.")
 	printRatio := flag.Bool("pr", false, "Print compression ratio.")
+	noName := flag.Bool("n", false, "Don't store name, modification time and permissions of input file.")
+	archiveMode := flag.Bool("archive", false, "Store input and files or directories given as arguments in archive.")
+	verbose := flag.Bool("v", false, "Print time spent in reading and writing, modeling and coding.")
+
+	coderOptions := helpers.EncodeFlags(flag.CommandLine)
+	startProfile := helpers.ProfileFlags(flag.CommandLine)
 
 	flag.Parse()
 
-	// Check if file is specified as argument
-	if *inPath == "" || *outPath == "" {
-		fmt.Fprintln(os.Stderr, "specify both input and output files path!")
-		flag.Usage()
+	// Collect archive entries
+	var archived []string
+	if *archiveMode {
+		if *inPath != "" {
+			archived = append(archived, *inPath)
+		}
+		archived = append(archived, flag.Args()...)
+		if len(archived) == 0 {
+			fmt.Fprintln(os.Stderr, "specify files to archive!")
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	if helpers.IsStdio(*outPath) && helpers.IsTerminal(os.Stdout) {
+		fmt.Fprintln(os.Stderr, "refusing to write compressed data to terminal, specify output file path!")
+		os.Exit(1)
+	}
+
+	opts, err := coderOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	prof, err := startProfile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
+	// os.Exit skips deferred calls, so prof.Exit is used after profiling is started
+	defer func() {
+		if err := prof.Stop(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}()
+
+	start := time.Now()
+	if *verbose {
+		opts.Timings = &timing.Timings{}
+		defer func() {
+			helpers.PrintTimings(os.Stderr, opts.Timings, time.Since(start))
+		}()
+	}
+
+	if *archiveMode {
+		if err := createArchive(*outPath, archived, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "got error while archiving: %v\n", err)
+			prof.Exit(1)
+		}
+		return
+	}
+
+	// Ratio is found out from sizes of files
+	if *printRatio && (helpers.IsStdio(*inPath) || helpers.IsStdio(*outPath)) {
+		fmt.Fprintln(os.Stderr, "specify both input and output files path to print compression ratio!")
+		prof.Exit(1)
+	}
 
 	// Open file to read data
-	inFile, err := os.Open(*inPath)
+	inFile, err := helpers.OpenInput(*inPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "can't open file %s\n", *inPath)
-		os.Exit(1)
+		prof.Exit(1)
 	}
 	defer inFile.Close()
 
 	// Open file to write compressed data
-	outFile, err := os.Create(*outPath)
+	outFile, err := helpers.CreateOutput(*outPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "can't create file %s\n", *outPath)
-		os.Exit(1)
+		prof.Exit(1)
 	}
 	defer outFile.Close()
 
-	err = arithmetic.Encode(inFile, outFile)
+	if *noName || helpers.IsStdio(*inPath) {
+		err = arithmetic.Encode(inFile, outFile, opts)
+	} else {
+		err = arithmetic.EncodeFile(inFile, outFile, opts)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "got error while encoding: %v\n", err)
-		os.Exit(1)
+		prof.Exit(1)
 	}
 
 	if *printRatio == true {
 		if err := helpers.PrintRatio(inFile, outFile); err != nil {
 			fmt.Fprintf(os.Stderr, "got error while getting compression ratio: %v\n", err)
-			os.Exit(2)
+			prof.Exit(2)
+		}
+	}
+}
+
+// createArchive stores files and directories in archive at path
+func createArchive(path string, names []string, opts config.Options) error {
+	outFile, err := helpers.CreateOutput(path)
+	if err != nil {
+		return err
+	}
+	skipped := func(err error) {
+		fmt.Fprintf(os.Stderr, "skipping: %v\n", err)
+	}
+	if err := archive.Create(outFile, names, opts, skipped); err != nil {
+		outFile.Close()
+		if !helpers.IsStdio(path) {
+			os.Remove(path)
 		}
+		return err
 	}
+	return outFile.Close()
 }
@@ -0,0 +1,512 @@
+// Package archive implements compressed archives of files and directories.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+)
+
+// Archive layout, compressed as a single arithmetic stream:
+//
+//	magic              4 bytes  "ARCH"
+//	version            1 byte
+//	entries, each of them:
+//	  type             1 byte   typeFile or typeDir, typeEnd terminates archive
+//	  path length      uvarint
+//	  path             slash separated path relative to archive root
+//	  mode             uvarint  permission bits of fs.FileMode
+//	  mtime            varint   modification time in Unix nanoseconds
+//	  size             uvarint  only for typeFile
+//	  content          size bytes, only for typeFile
+
+// magic begins every archive
+var magic = []byte("ARCH")
+
+// version of the archive format
+const version = 1
+
+// Entry types
+const (
+	typeEnd  = 0
+	typeFile = 1
+	typeDir  = 2
+)
+
+// maxPathLen is the maximal length of entry path
+const maxPathLen = 4096
+
+var (
+	// ErrFormat is returned when archive is malformed
+	ErrFormat = errors.New("archive: invalid format")
+	// ErrInsecurePath is returned when entry path is absolute or leads out of archive root
+	ErrInsecurePath = errors.New("archive: insecure path")
+	// ErrUnsupported is returned when file can't be stored in archive
+	ErrUnsupported = errors.New("archive: unsupported file type")
+)
+
+// Entry describes file or directory stored in archive
+type Entry struct {
+	Path    string // slash separated path relative to archive root
+	Mode    fs.FileMode
+	ModTime time.Time
+	Size    int64 // number of content bytes, 0 for directories
+}
+
+// IsDir reports whether e is a directory
+func (e Entry) IsDir() bool {
+	return e.Mode.IsDir()
+}
+
+// validPath reports whether name is a relative path, which stays inside archive root
+func validPath(name string) bool {
+	if name == "" || name == "." || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") {
+		return false
+	}
+	if path.Clean(name) != name || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// Writer writes entries of archive. Content of every file entry is written after its header.
+type Writer struct {
+	z         *arithmetic.Writer
+	w         *bufio.Writer
+	remaining int64 // number of content bytes left to write for current entry
+	err       error
+
+	// Skipped is called by AddFile for files of unsupported type, e.g. symlinks, which are left out of archive.
+	// If nil, they are left out silently.
+	Skipped func(err error)
+}
+
+// NewWriter returns Writer compressing archive to w with coder parameters opts.
+func NewWriter(w io.Writer, opts config.Options) *Writer {
+	a := &Writer{z: arithmetic.NewWriter(w, -1, opts)}
+	a.w = bufio.NewWriter(a.z)
+	a.w.Write(magic)
+	a.w.WriteByte(version)
+	return a
+}
+
+// WriteHeader starts new entry. For files exactly e.Size bytes of content have to be written afterwards.
+func (a *Writer) WriteHeader(e Entry) error {
+	if a.err != nil {
+		return a.err
+	}
+	if a.remaining != 0 {
+		a.err = fmt.Errorf("archive: %d bytes of content are missing", a.remaining)
+		return a.err
+	}
+	if !validPath(e.Path) || len(e.Path) > maxPathLen {
+		return fmt.Errorf("%w: %q", ErrInsecurePath, e.Path)
+	}
+
+	typ := byte(typeFile)
+	switch {
+	case e.Mode.IsDir():
+		typ = typeDir
+	case !e.Mode.IsRegular():
+		return fmt.Errorf("%w: %s is %v", ErrUnsupported, e.Path, e.Mode.Type())
+	case e.Size < 0:
+		return fmt.Errorf("archive: negative size of %s", e.Path)
+	}
+
+	buf := &bytes.Buffer{}
+	varint := make([]byte, binary.MaxVarintLen64)
+	buf.WriteByte(typ)
+	buf.Write(varint[:binary.PutUvarint(varint, uint64(len(e.Path)))])
+	buf.WriteString(e.Path)
+	buf.Write(varint[:binary.PutUvarint(varint, uint64(e.Mode.Perm()))])
+	buf.Write(varint[:binary.PutVarint(varint, e.ModTime.UnixNano())])
+	if typ == typeFile {
+		buf.Write(varint[:binary.PutUvarint(varint, uint64(e.Size))])
+		a.remaining = e.Size
+	}
+
+	_, a.err = a.w.Write(buf.Bytes())
+	return a.err
+}
+
+// Write writes content of current file entry.
+func (a *Writer) Write(p []byte) (n int, err error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	if int64(len(p)) > a.remaining {
+		return 0, errors.New("archive: content is larger than entry size")
+	}
+	n, a.err = a.w.Write(p)
+	a.remaining -= int64(n)
+	return n, a.err
+}
+
+// Close terminates archive. It does not close the underlying writer.
+func (a *Writer) Close() error {
+	if a.err != nil {
+		return a.err
+	}
+	if a.remaining != 0 {
+		a.err = fmt.Errorf("archive: %d bytes of content are missing", a.remaining)
+		return a.err
+	}
+	a.w.WriteByte(typeEnd)
+	if a.err = a.w.Flush(); a.err != nil {
+		return a.err
+	}
+	a.err = a.z.Close()
+	return a.err
+}
+
+// AddFile stores file or directory tree at name. Paths in archive are relative to parent directory of name.
+// Symlinks aren't followed, and they and other files of unsupported type are skipped.
+func (a *Writer) AddFile(name string) error {
+	name = filepath.Clean(name)
+	base := filepath.Dir(name)
+	if filepath.Base(name) == ".." || name == "." {
+		// Store contents of the directory itself
+		base = name
+	}
+
+	return filepath.WalkDir(name, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, file)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			if a.Skipped != nil {
+				a.Skipped(fmt.Errorf("%w: %s is %v", ErrUnsupported, file, info.Mode().Type()))
+			}
+			return nil
+		}
+
+		e := Entry{Path: filepath.ToSlash(rel), Mode: info.Mode(), ModTime: info.ModTime()}
+		if info.Mode().IsRegular() {
+			e.Size = info.Size()
+		}
+		if err := a.WriteHeader(e); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.CopyN(a, f, e.Size); err != nil {
+			return fmt.Errorf("archive: %s: %w", file, err)
+		}
+		return nil
+	})
+}
+
+// Reader reads entries of archive. Content of file entry is read after Next returns it.
+type Reader struct {
+	z         *arithmetic.Reader
+	r         *bufio.Reader
+	remaining int64 // number of content bytes left to read for current entry
+	err       error
+}
+
+// NewReader returns Reader of archive compressed in r.
+// Coder parameters are taken from the stream header, only custom model is taken from opts.
+func NewReader(r io.Reader, opts config.Options) (*Reader, error) {
+	z, err := arithmetic.NewReader(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	a := &Reader{z: z, r: bufio.NewReader(z)}
+
+	fixed := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(a.r, fixed); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if !bytes.Equal(fixed[:len(magic)], magic) {
+		return nil, fmt.Errorf("%w: not an archive", ErrFormat)
+	}
+	if fixed[len(magic)] != version {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrFormat, fixed[len(magic)])
+	}
+	return a, nil
+}
+
+// Next skips the rest of current entry, and returns the next one. It returns io.EOF at the end of archive.
+func (a *Reader) Next() (*Entry, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	if a.remaining > 0 {
+		if _, a.err = io.CopyN(io.Discard, a.r, a.remaining); a.err != nil {
+			a.err = unexpectedEOF(a.err)
+			return nil, a.err
+		}
+		a.remaining = 0
+	}
+
+	e, err := a.readHeader()
+	if err != nil {
+		a.err = err
+		return nil, err
+	}
+	return e, nil
+}
+
+func (a *Reader) readHeader() (*Entry, error) {
+	typ, err := a.r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if typ == typeEnd {
+		// Make underlying reader verify checksum
+		if _, err := a.r.ReadByte(); err != io.EOF {
+			if err == nil {
+				err = fmt.Errorf("%w: data after the end of archive", ErrFormat)
+			}
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	if typ != typeFile && typ != typeDir {
+		return nil, fmt.Errorf("%w: unknown entry type %d", ErrFormat, typ)
+	}
+
+	length, err := binary.ReadUvarint(a.r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if length > maxPathLen {
+		return nil, fmt.Errorf("%w: path is too long", ErrFormat)
+	}
+	name := make([]byte, length)
+	if _, err := io.ReadFull(a.r, name); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	perm, err := binary.ReadUvarint(a.r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	mtime, err := binary.ReadVarint(a.r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	e := &Entry{
+		Path:    string(name),
+		Mode:    fs.FileMode(perm) & fs.ModePerm,
+		ModTime: time.Unix(0, mtime),
+	}
+	if typ == typeDir {
+		e.Mode |= fs.ModeDir
+	} else {
+		size, err := binary.ReadUvarint(a.r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if int64(size) < 0 {
+			return nil, fmt.Errorf("%w: size of %q is too large", ErrFormat, e.Path)
+		}
+		e.Size = int64(size)
+		a.remaining = e.Size
+	}
+	return e, nil
+}
+
+// Read reads content of current file entry.
+func (a *Reader) Read(p []byte) (n int, err error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	if a.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > a.remaining {
+		p = p[:a.remaining]
+	}
+	n, err = a.r.Read(p)
+	a.remaining -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		a.err = err
+	}
+	return n, err
+}
+
+// Create compresses files and directory trees at names into archive written to w.
+// Skipped files are reported to skipped, if it isn't nil.
+func Create(w io.Writer, names []string, opts config.Options, skipped func(err error)) error {
+	a := NewWriter(w, opts)
+	a.Skipped = skipped
+	for _, name := range names {
+		if err := a.AddFile(name); err != nil {
+			return err
+		}
+	}
+	return a.Close()
+}
+
+// List returns entries of archive read from r.
+func List(r io.Reader, opts config.Options) ([]Entry, error) {
+	a, err := NewReader(r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for {
+		e, err := a.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, *e)
+	}
+}
+
+// Extract restores entries of archive read from r into directory dir.
+// Entries with paths leading out of dir, directly or through symlinks already in dir,
+// are rejected with ErrInsecurePath before anything is written for them.
+// Existing files are refused with fs.ErrExist, unless overwrite is set.
+// Then they are removed and created anew, so links in dir aren't written through.
+func Extract(r io.Reader, dir string, opts config.Options, overwrite bool) (err error) {
+	a, err := NewReader(r, opts)
+	if err != nil {
+		return err
+	}
+
+	// Permissions and times of directories are restored at the end,
+	// since creating files in them changes mtime, and read-only ones can't be filled.
+	var dirs []Entry
+	defer func() {
+		for i := len(dirs) - 1; i >= 0; i-- {
+			name := filepath.Join(dir, filepath.FromSlash(dirs[i].Path))
+			if cerr := os.Chmod(name, dirs[i].Mode.Perm()); cerr != nil && err == nil {
+				err = cerr
+			}
+			if cerr := os.Chtimes(name, dirs[i].ModTime, dirs[i].ModTime); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}()
+
+	for {
+		e, err := a.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !validPath(e.Path) {
+			return fmt.Errorf("%w: %q", ErrInsecurePath, e.Path)
+		}
+		if err := checkSymlinks(dir, e.Path); err != nil {
+			return err
+		}
+
+		name := filepath.Join(dir, filepath.FromSlash(e.Path))
+		if e.IsDir() {
+			if err := os.MkdirAll(name, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, *e)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := extractFile(a, name, e, overwrite); err != nil {
+			return err
+		}
+	}
+}
+
+// checkSymlinks returns ErrInsecurePath, if any of existing elements of entry path in dir is a symlink,
+// since creating the entry would follow it, possibly out of dir
+func checkSymlinks(dir string, entry string) error {
+	name := dir
+	for _, elem := range strings.Split(entry, "/") {
+		name = filepath.Join(name, elem)
+		info, err := os.Lstat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %q leads through symlink %s", ErrInsecurePath, entry, name)
+		}
+	}
+	return nil
+}
+
+// extractFile writes content of current entry to new file name, and restores its permissions and mtime.
+// If overwrite is set, existing file is removed first. File is created exclusively,
+// so neither a file, nor a link put in its place after checkSymlinks, is written through.
+func extractFile(a *Reader, name string, e *Entry, overwrite bool) error {
+	if overwrite {
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL|oNoFollow, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, a); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(name, e.Mode.Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(name, e.ModTime, e.ModTime)
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF, since archive can't end before terminating entry
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build aix || darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd illumos linux netbsd openbsd solaris
+
+package archive
+
+import "syscall"
+
+// oNoFollow makes opening of file fail, if it is a symlink
+const oNoFollow = syscall.O_NOFOLLOW
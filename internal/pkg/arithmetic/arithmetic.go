@@ -2,194 +2,105 @@ package arithmetic
 
 import (
 	"bufio"
-	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/cravtos/arithmetic/internal/pkg/config"
-	"github.com/cravtos/arithmetic/internal/pkg/table"
-	"github.com/icza/bitio"
+	"github.com/cravtos/arithmetic/internal/pkg/timing"
 )
 
-// Interval delimiters
-const top uint64 = (1 << config.IntervalBitsUsed) - 1
-const firstQuart = (top + 1) / 4
-const half = firstQuart * 2
-const thirdQuart = firstQuart * 3
-
-func bitsPlusFollow(to *bitio.Writer, bit uint64, bitsToFollow uint64) (err error) {
-	to.TryWriteBitsUnsafe(bit, 1)
-
-	flipped := uint64(1)
-	if bit == 1 {
-		flipped = 0
+// inputSize returns number of bytes left in in, if it can be found out without reading it
+func inputSize(in io.Reader) (size uint64, ok bool) {
+	switch v := in.(type) {
+	case interface{ Len() int }:
+		// bytes.Buffer, bytes.Reader, strings.Reader
+		return uint64(v.Len()), true
+	case *os.File:
+		stat, err := v.Stat()
+		if err != nil || !stat.Mode().IsRegular() {
+			return 0, false
+		}
+		pos, err := v.Seek(0, io.SeekCurrent)
+		if err != nil || pos > stat.Size() {
+			return 0, false
+		}
+		return uint64(stat.Size() - pos), true
 	}
+	return 0, false
+}
 
-
-	for bitsToFollow > 0 {
-		to.TryWriteBitsUnsafe(flipped, 1)
-		bitsToFollow--
+// fileMeta returns name, modification time and permissions of regular file f
+func fileMeta(f *os.File) Meta {
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		return Meta{}
 	}
-
-	return to.TryError
+	return Meta{Name: filepath.Base(f.Name()), ModTime: stat.ModTime(), Mode: stat.Mode().Perm()}
 }
 
-func Encode(inFile *os.File, outFile *os.File) (err error) {
-	r := bufio.NewReader(inFile)
-	w := bitio.NewWriter(outFile)
-
-	t := table.NewTable()
+// EncodeFile compresses inFile to outFile. Name, modification time and permissions of inFile are recorded in header.
+func EncodeFile(inFile *os.File, outFile *os.File, opts config.Options) error {
+	return encode(inFile, outFile, opts, fileMeta(inFile))
+}
 
-	// Get information for header
-	inStat, err := inFile.Stat()
-	if err != nil {
-		return err
-	}
-	inSize := uint64(inStat.Size())
+// Encode compresses data read from in and writes it to out.
+// If length of in can't be found out beforehand (pipes, sockets, etc.), end of data is marked by EOF symbol.
+// Static model reads in twice if it can seek, otherwise in is kept in memory.
+// Stream is encoded with coder parameters opts, which are recorded in its header.
+func Encode(in io.Reader, out io.Writer, opts config.Options) error {
+	return encode(in, out, opts, Meta{})
+}
 
-	// Write header
-	if err := w.WriteBitsUnsafe(inSize, 64); err != nil {
-		return err
+func encode(in io.Reader, out io.Writer, opts config.Options, meta Meta) error {
+	if err := opts.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrParameters, err)
 	}
 
-	// Begin compressing
-	l := uint64(0)
-	h := top
-	bitsToFollow := uint64(0)
-
-	v, err := r.ReadByte()
-	nEncoded := 0
-	for err == nil {
-		denom := t.GetInterval(table.ABCSize - 1)
-		delta := h - l + 1
-		h = l + t.GetInterval(int(v))*delta/denom - 1
-		l = l + t.GetInterval(int(v)-1)*delta/denom
-
-		for {
-			if h < half {
-				if err := bitsPlusFollow(w, 0, bitsToFollow); err != nil {
-					return err
-				}
-				bitsToFollow = 0
-			} else if l >= half {
-				if err := bitsPlusFollow(w, 1, bitsToFollow); err != nil {
-					return err
-				}
-				bitsToFollow = 0
-				l -= half
-				h -= half
-			} else if l >= firstQuart && h < thirdQuart {
-				bitsToFollow++
-				l -= firstQuart
-				h -= firstQuart
-			} else {
-				break
-			}
-
-			l <<= 1
-			h <<= 1
-			h += 1
-
-			if l&top != l || h&top != h {
-				return errors.New("got overflow")
-			}
-		}
-
-		t.UpdateCount(v)
-		nEncoded += 1
-		if nEncoded%config.UpdateRangesRate == 0 {
-			t.UpdateRanges(0)
-		}
-		v, err = r.ReadByte()
+	size := int64(-1)
+	if inSize, ok := inputSize(in); ok {
+		size = int64(inSize)
 	}
 
-	// Encode last interval
-	bitsToFollow += 1
-	if l < firstQuart {
-		if err := bitsPlusFollow(w, 0, bitsToFollow); err != nil {
-			return err
-		}
-	} else {
-		if err := bitsPlusFollow(w, 1, bitsToFollow); err != nil {
+	w := NewWriter(out, size, opts)
+	w.SetMeta(meta)
+	if rs, ok := in.(io.ReadSeeker); ok && size >= 0 {
+		// Count data for static model beforehand, so Writer needn't keep it
+		if err := w.prescan(rs); err != nil {
 			return err
 		}
 	}
-	bitsToFollow = 0
-
-	// Write full interval
-	if err = w.WriteBits(l, config.IntervalBitsUsed); err != nil {
+	if opts.Timings != nil {
+		in = timing.Reader(in, opts.Timings)
+	}
+	if _, err := io.Copy(w, bufio.NewReader(in)); err != nil {
 		return err
 	}
 
-	// Flush everything to file
+	// Flush everything to out
 	return w.Close()
 }
 
-func Decode(in *os.File, out *os.File) (err error) {
-	r := bitio.NewReader(in)
-	w := bufio.NewWriter(out)
-	t := table.NewTable()
-
-	// Read header
-	var nEncoded uint64
-	if nEncoded, err = r.ReadBits(64); err != nil {
-		return err
-	}
+// DecodeFile decompresses inFile to outFile.
+func DecodeFile(inFile *os.File, outFile *os.File, opts config.Options) error {
+	return Decode(inFile, outFile, opts)
+}
 
-	// Begin decompressing
-	value, err := r.ReadBits(config.IntervalBitsUsed)
+// Decode decompresses data read from in and writes it to out.
+// Coder parameters are taken from stream header, only custom model is taken from opts.
+func Decode(in io.Reader, out io.Writer, opts config.Options) error {
+	r, err := NewReader(in, opts)
 	if err != nil {
 		return err
 	}
 
-	l := uint64(0)
-	h := top
-	for i := uint64(1); i <= nEncoded; i++ {
-		denom := t.GetInterval(table.ABCSize - 1)
-
-		delta := h - l + 1
-		interval := ((value-l+1)*denom - 1) / delta
-		symbol := t.GetSymbol(interval)
-
-		h = l + t.GetInterval(int(symbol))*delta/denom - 1
-		l = l + t.GetInterval(int(symbol)-1)*delta/denom
-
-		for {
-			if h < half {
-				// do nothing
-			} else if l >= half {
-				l -= half
-				h -= half
-				value -= half
-			} else if l >= firstQuart && h < thirdQuart {
-				l -= firstQuart
-				h -= firstQuart
-				value -= firstQuart
-			} else {
-				break
-			}
-			l <<= 1
-			h <<= 1
-			h += 1
-
-			inBit, err := r.ReadBits(1)
-			if err != nil {
-				return err
-			}
-			value <<= 1
-			value |= inBit & 1
-
-			if l&top != l || h&top != h || value&top != value {
-				return errors.New("got overflow")
-			}
-		}
-
-		t.UpdateCount(symbol)
-		if i%config.UpdateRangesRate == 0 {
-			t.UpdateRanges(0)
-		}
-		if err = w.WriteByte(symbol); err != nil {
-			return err
-		}
+	if opts.Timings != nil {
+		out = timing.Writer(out, opts.Timings)
+	}
+	w := bufio.NewWriter(out)
+	if _, err := io.Copy(w, r); err != nil {
+		return err
 	}
 
 	return w.Flush()
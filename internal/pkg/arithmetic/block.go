@@ -0,0 +1,459 @@
+package arithmetic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"runtime"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/table"
+	"github.com/icza/bitio"
+)
+
+// workers returns number of blocks coded in parallel
+func workers(opts config.Options) int {
+	if opts.Workers > 0 {
+		return opts.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// encodeBlock codes data with its own model and interval state.
+// If coding doesn't make data smaller, data is returned as is, so it is stored.
+func encodeBlock(data []byte, h header, opts config.Options) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := bitio.NewWriter(buf)
+	enc := newEncoder(w, opts)
+
+	m, err := h.newModel(opts)
+	if err != nil {
+		return nil, err
+	}
+	if static, ok := m.(*table.Static); ok {
+		static.Count(data)
+	}
+	m = timed(m, opts)
+
+	stop := measure(m)
+	for _, v := range data {
+		if err := m.EncodeSymbol(enc, int(v)); err != nil {
+			return nil, err
+		}
+	}
+	stop()
+	if err := enc.finish(); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() >= len(data) {
+		return data, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeBlock decodes size bytes from data coded by encodeBlock. Data of the same size is stored as is.
+// Block data begins at byte offset of stream, and its first symbol has index start, which errors are reported with.
+func decodeBlock(data []byte, size uint64, h header, opts config.Options, offset, start uint64) ([]byte, error) {
+	if uint64(len(data)) == size {
+		return data, nil
+	}
+
+	r := bitio.NewReader(bytes.NewReader(data))
+	dec, err := newDecoder(r, opts, int64(len(data)))
+	if err != nil {
+		return nil, decodeError(err, offset*8, start)
+	}
+
+	m, err := h.newModel(opts)
+	if err != nil {
+		return nil, err
+	}
+	m = timed(m, opts)
+
+	// Memory is taken as data is decoded, not as much as corrupted size claims
+	out := make([]byte, 0, minUint64(size, 64<<10))
+	stop := measure(m)
+	for i := uint64(0); i < size; i++ {
+		symbol, err := m.DecodeSymbol(dec)
+		if err == nil && symbol >= table.ABCSize {
+			err = fmt.Errorf("%w: invalid symbol %d", ErrCorrupt, symbol)
+		}
+		if err != nil {
+			return nil, decodeError(err, offset*8+dec.position(), start+i)
+		}
+		out = append(out, byte(symbol))
+	}
+	stop()
+	return out, nil
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// uvarintLen returns number of bytes in uvarint encoding of v
+func uvarintLen(v uint64) uint64 {
+	n := uint64(1)
+	for ; v >= 0x80; v >>= 7 {
+		n++
+	}
+	return n
+}
+
+// blockJob is a block coded in its own goroutine
+type blockJob struct {
+	entry blockEntry // position of block, when it is decoded
+	size  uint64     // number of original bytes
+	crc   uint32     // checksum of original bytes
+	data  []byte     // coded block
+	err   error
+	done  chan struct{}
+}
+
+// blockEntry describes block in index
+type blockEntry struct {
+	offset uint64 // position of coded data in stream
+	size   uint64 // number of original bytes
+	length uint64 // number of coded bytes
+	crc    uint32 // checksum of original bytes
+}
+
+// writeIndex writes index of blocks, followed by its length
+func writeIndex(w io.Writer, index []blockEntry) error {
+	buf := &bytes.Buffer{}
+	varint := make([]byte, binary.MaxVarintLen64)
+	buf.Write(varint[:binary.PutUvarint(varint, uint64(len(index)))])
+	for _, e := range index {
+		buf.Write(varint[:binary.PutUvarint(varint, e.offset)])
+		buf.Write(varint[:binary.PutUvarint(varint, e.size)])
+		buf.Write(varint[:binary.PutUvarint(varint, e.length)])
+		binary.Write(buf, binary.BigEndian, e.crc)
+	}
+	binary.Write(buf, binary.BigEndian, uint32(buf.Len()))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// indexLength returns number of bytes written by writeIndex
+func indexLength(index []blockEntry) uint64 {
+	n := uvarintLen(uint64(len(index))) + 4
+	for _, e := range index {
+		n += uvarintLen(e.offset) + uvarintLen(e.size) + uvarintLen(e.length) + 4
+	}
+	return n
+}
+
+// byteReader is satisfied by bitio.Reader and bytes.Reader
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readIndex reads index of blocks written by writeIndex, and checks that blocks are valid for header h
+func readIndex(br byteReader, h header) ([]blockEntry, error) {
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, truncated(err)
+	}
+
+	var index []blockEntry
+	fixed := make([]byte, 4)
+	for i := uint64(0); i < count; i++ {
+		var e blockEntry
+		if e.offset, err = binary.ReadUvarint(br); err != nil {
+			return nil, truncated(err)
+		}
+		if e.size, err = binary.ReadUvarint(br); err != nil {
+			return nil, truncated(err)
+		}
+		if e.length, err = binary.ReadUvarint(br); err != nil {
+			return nil, truncated(err)
+		}
+		if _, err = io.ReadFull(br, fixed); err != nil {
+			return nil, truncated(err)
+		}
+		e.crc = binary.BigEndian.Uint32(fixed)
+
+		if e.size == 0 || e.size > h.blockSize || e.length > e.size {
+			return nil, fmt.Errorf("%w: invalid index entry of block %d", ErrCorrupt, i)
+		}
+		index = append(index, e)
+	}
+
+	// Skip index length, which is only needed to find index from the end of stream
+	if _, err = io.ReadFull(br, fixed); err != nil {
+		return nil, truncated(err)
+	}
+	return index, nil
+}
+
+// blockWriter encodes blocks in parallel, and writes them out in order
+type blockWriter struct {
+	w       io.Writer
+	h       header
+	opts    config.Options
+	workers int
+	queue   []*blockJob
+
+	offset uint64       // number of bytes written to w
+	index  []blockEntry // blocks written, if h has flagIndex
+}
+
+func newBlockWriter(w io.Writer, h header, opts config.Options) *blockWriter {
+	return &blockWriter{w: w, h: h, opts: opts, workers: workers(opts)}
+}
+
+// add starts encoding of data, which mustn't be modified afterwards.
+// If all workers are busy, it waits for the oldest block and writes it out.
+func (b *blockWriter) add(data []byte) error {
+	if len(b.queue) >= b.workers {
+		if err := b.writeNext(); err != nil {
+			return err
+		}
+	}
+
+	job := &blockJob{size: uint64(len(data)), done: make(chan struct{})}
+	b.queue = append(b.queue, job)
+	go func() {
+		defer close(job.done)
+		job.crc = crc32.Checksum(data, crcTable)
+		job.data, job.err = encodeBlock(data, b.h, b.opts)
+	}()
+	return nil
+}
+
+// writeNext waits for the oldest block and writes it out
+func (b *blockWriter) writeNext() error {
+	job := b.queue[0]
+	b.queue = b.queue[1:]
+	<-job.done
+	if job.err != nil {
+		return job.err
+	}
+
+	varint := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutUvarint(varint, job.size)
+	n += binary.PutUvarint(varint[n:], uint64(len(job.data)))
+	if _, err := b.w.Write(varint[:n]); err != nil {
+		return err
+	}
+	b.offset += uint64(n)
+	if b.h.flags&flagIndex != 0 {
+		b.index = append(b.index, blockEntry{offset: b.offset, size: job.size, length: uint64(len(job.data)), crc: job.crc})
+	}
+	if _, err := b.w.Write(job.data); err != nil {
+		return err
+	}
+	b.offset += uint64(len(job.data))
+	return nil
+}
+
+// close writes out all blocks left, followed by terminating zero size and index
+func (b *blockWriter) close() error {
+	for len(b.queue) > 0 {
+		if err := b.writeNext(); err != nil {
+			b.wait()
+			return err
+		}
+	}
+	if _, err := b.w.Write([]byte{0}); err != nil {
+		return err
+	}
+	if b.h.flags&flagIndex != 0 {
+		return writeIndex(b.w, b.index)
+	}
+	return nil
+}
+
+// wait lets blocks in progress finish, so no goroutines are left behind
+func (b *blockWriter) wait() {
+	for _, job := range b.queue {
+		<-job.done
+	}
+	b.queue = nil
+}
+
+// readAhead is number of original bytes of blocks, which blockReader decodes ahead.
+// Sizes of blocks are read from stream, so they can't be trusted to bound memory.
+// One block is decoded even if it is larger.
+const readAhead = 64 << 20
+
+// blockReader reads blocks ahead, and decodes them in parallel.
+// Index of seekable stream follows the blocks, so their checksums in it are checked only when it is reached,
+// after data of the blocks is returned.
+type blockReader struct {
+	r       *bitio.Reader
+	h       header
+	opts    config.Options
+	workers int
+	queue   []*blockJob
+	queued  uint64      // number of original bytes of blocks in queue
+	frame   *blockEntry // frame of the next block, which is read, but not queued yet
+	end     bool        // set when terminating zero size is read
+
+	index  []blockEntry // index read from stream
+	blocks []blockEntry // blocks decoded so far, if stream has index
+
+	offset uint64 // number of bytes read from stream
+	start  uint64 // index of the first symbol of the next block
+}
+
+func newBlockReader(r *bitio.Reader, h header, opts config.Options) *blockReader {
+	return &blockReader{r: r, h: h, opts: opts, workers: workers(opts), offset: h.length()}
+}
+
+// next returns the next decoded block. It returns io.EOF after the last block.
+func (b *blockReader) next() ([]byte, error) {
+	for !b.end && len(b.queue) < b.workers {
+		if b.frame == nil {
+			if err := b.readFrame(); err != nil {
+				b.wait()
+				return nil, err
+			}
+			continue
+		}
+		if len(b.queue) > 0 && b.queued+b.frame.size > readAhead {
+			break
+		}
+		if err := b.readNext(); err != nil {
+			b.wait()
+			return nil, err
+		}
+	}
+	if len(b.queue) == 0 {
+		if b.h.flags&flagIndex != 0 {
+			if err := b.checkIndex(); err != nil {
+				return nil, err
+			}
+		}
+		return nil, io.EOF
+	}
+
+	job := b.queue[0]
+	b.queue = b.queue[1:]
+	b.queued -= job.size
+	<-job.done
+	if job.err != nil {
+		b.wait()
+		return nil, job.err
+	}
+	if b.h.flags&flagIndex != 0 {
+		job.entry.crc = crc32.Checksum(job.data, crcTable)
+		b.blocks = append(b.blocks, job.entry)
+	}
+	return job.data, nil
+}
+
+// checkIndex checks that index describes blocks decoded
+func (b *blockReader) checkIndex() error {
+	if len(b.index) != len(b.blocks) {
+		err := fmt.Errorf("%w: index has %d blocks, stream has %d", ErrCorrupt, len(b.index), len(b.blocks))
+		return decodeError(err, b.offset*8, b.start)
+	}
+	start := uint64(0)
+	for i, e := range b.blocks {
+		switch {
+		case b.index[i].offset != e.offset || b.index[i].size != e.size || b.index[i].length != e.length:
+			err := fmt.Errorf("%w: index entry of block %d doesn't match block", ErrCorrupt, i)
+			return decodeError(err, e.offset*8, start)
+		case b.index[i].crc != e.crc:
+			err := fmt.Errorf("%w: block %d", ErrChecksum, i)
+			return decodeError(err, e.offset*8, start)
+		}
+		start += e.size
+	}
+	return nil
+}
+
+// readFrame reads size and length of the next block, or terminating zero size followed by index
+func (b *blockReader) readFrame() error {
+	size, err := binary.ReadUvarint(b.r)
+	if err != nil {
+		return decodeError(err, b.offset*8, b.start)
+	}
+	if size == 0 {
+		b.end = true
+		b.offset++
+		if b.h.flags&flagIndex != 0 {
+			index, err := readIndex(b.r, b.h)
+			if err != nil {
+				return decodeError(err, b.offset*8, b.start)
+			}
+			b.index = index
+			b.offset += indexLength(index)
+		}
+		return nil
+	}
+	if size > b.h.blockSize {
+		err := fmt.Errorf("%w: block of %d bytes is larger than %d", ErrCorrupt, size, b.h.blockSize)
+		return decodeError(err, b.offset*8, b.start)
+	}
+
+	length, err := binary.ReadUvarint(b.r)
+	if err != nil {
+		return decodeError(err, b.offset*8, b.start)
+	}
+	if length > size {
+		err := fmt.Errorf("%w: block of %d bytes is coded with %d bytes", ErrCorrupt, size, length)
+		return decodeError(err, b.offset*8, b.start)
+	}
+	b.offset += uvarintLen(size) + uvarintLen(length)
+	if err := checkLimit(b.opts, b.start+size, b.offset+length); err != nil {
+		return decodeError(err, b.offset*8, b.start)
+	}
+	// Blocks are decoded ahead, so every one of them is limited by its own length too
+	if err := checkLimit(b.opts, size, length); err != nil {
+		return decodeError(err, b.offset*8, b.start)
+	}
+	b.frame = &blockEntry{offset: b.offset, size: size, length: length}
+	return nil
+}
+
+// readNext reads data of the next block and starts its decoding
+func (b *blockReader) readNext() error {
+	size, length := b.frame.size, b.frame.length
+	buf := &bytes.Buffer{}
+	if _, err := io.CopyN(buf, b.r, int64(length)); err != nil {
+		return decodeError(err, b.offset*8, b.start)
+	}
+	data := buf.Bytes()
+
+	job := &blockJob{size: size, done: make(chan struct{})}
+	job.entry = *b.frame
+	b.frame = nil
+	b.queue = append(b.queue, job)
+	b.queued += size
+	offset, start := b.offset, b.start
+	go func() {
+		defer close(job.done)
+		job.data, job.err = decodeBlock(data, size, b.h, b.opts, offset, start)
+	}()
+	b.offset += length
+	b.start += size
+	return nil
+}
+
+// wait lets blocks in progress finish, so no goroutines are left behind
+func (b *blockReader) wait() {
+	for _, job := range b.queue {
+		<-job.done
+	}
+	b.queue = nil
+}
+
+// truncated converts io.EOF to ErrTruncated, since stream can't end in the middle of block or index
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
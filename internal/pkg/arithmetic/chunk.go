@@ -0,0 +1,245 @@
+package arithmetic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/model"
+	"github.com/cravtos/arithmetic/internal/pkg/table"
+	"github.com/icza/bitio"
+)
+
+// chunkSize is number of bytes in chunk. Only one chunk is kept along with its coded form,
+// so stream isn't held back, and memory doesn't grow with data.
+const chunkSize = 128 << 10
+
+// chunkWriter codes chunks with one model, and writes every chunk coded, or as is if coding doesn't make it smaller.
+// Decoder doesn't see data of stored chunk, so model starts anew after it.
+type chunkWriter struct {
+	w    io.Writer
+	h    header
+	opts config.Options
+	m    model.Coder
+
+	// static is set for static model, which keeps its counts of all data, when it starts anew
+	static *table.Static
+
+	coded bytes.Buffer
+}
+
+func newChunkWriter(w io.Writer, h header, opts config.Options) (*chunkWriter, error) {
+	c := &chunkWriter{w: w, h: h, opts: opts}
+	m, err := h.newModel(opts)
+	if err != nil {
+		return nil, err
+	}
+	c.static, _ = m.(*table.Static)
+	c.m = timed(m, opts)
+	return c, nil
+}
+
+// write codes data as the next chunk, and writes it out
+func (c *chunkWriter) write(data []byte) error {
+	c.coded.Reset()
+	w := bitio.NewWriter(&c.coded)
+	enc := newEncoder(w, c.opts)
+
+	stop := measure(c.m)
+	for _, v := range data {
+		if err := c.m.EncodeSymbol(enc, int(v)); err != nil {
+			return err
+		}
+	}
+	stop()
+	if err := enc.finish(); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	coded := c.coded.Bytes()
+	if len(coded) >= len(data) {
+		coded = data
+		if err := c.restart(); err != nil {
+			return err
+		}
+	}
+
+	varint := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutUvarint(varint, uint64(len(data)))
+	n += binary.PutUvarint(varint[n:], uint64(len(coded)))
+	if _, err := c.w.Write(varint[:n]); err != nil {
+		return err
+	}
+	_, err := c.w.Write(coded)
+	return err
+}
+
+// restart starts model anew after stored chunk
+func (c *chunkWriter) restart() error {
+	if c.static != nil {
+		c.static.Restart()
+		return nil
+	}
+	m, err := c.h.newModel(c.opts)
+	if err != nil {
+		return err
+	}
+	c.m = timed(m, c.opts)
+	return nil
+}
+
+// close writes terminating zero size
+func (c *chunkWriter) close() error {
+	_, err := c.w.Write([]byte{0})
+	return err
+}
+
+// chunkReader decodes chunks written by chunkWriter
+type chunkReader struct {
+	r    *bitio.Reader
+	h    header
+	opts config.Options
+	m    model.Coder // nil after stored chunk, until the next coded chunk begins
+	dec  *decoder    // decoder of the current chunk, nil if it is stored
+
+	left   uint64 // number of bytes of the current chunk, which aren't decoded yet
+	length uint64 // number of coded bytes of the current chunk
+	offset uint64 // number of bytes read from stream, up to data of the current chunk if it is coded
+	n      uint64 // number of bytes decoded
+}
+
+func newChunkReader(r *bitio.Reader, h header, opts config.Options) (*chunkReader, error) {
+	m, err := h.newModel(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{r: r, h: h, opts: opts, m: timed(m, opts), offset: h.length()}, nil
+}
+
+// position returns number of bits read from stream
+func (c *chunkReader) position() uint64 {
+	if c.dec != nil {
+		return c.offset*8 + c.dec.position()
+	}
+	return c.offset * 8
+}
+
+// read decodes data of chunks into p. It returns io.EOF after the last chunk.
+func (c *chunkReader) read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if c.left == 0 {
+			if err := c.next(); err != nil {
+				return n, err
+			}
+		}
+		m := len(p) - n
+		if uint64(m) > c.left {
+			m = int(c.left)
+		}
+		if c.dec == nil {
+			m, err = c.readStored(p[n : n+m])
+		} else {
+			m, err = c.decode(p[n : n+m])
+		}
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// next reads frame of the next chunk
+func (c *chunkReader) next() error {
+	sized := c.h.flags&flagEOF == 0
+	size, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return decodeError(err, c.offset*8, c.n)
+	}
+	c.offset += uvarintLen(size)
+	if size == 0 {
+		if sized && c.n != c.h.size {
+			err := fmt.Errorf("%w: stream has %d bytes instead of %d", ErrCorrupt, c.n, c.h.size)
+			return decodeError(err, c.offset*8, c.n)
+		}
+		return io.EOF
+	}
+	if sized && size > c.h.size-c.n {
+		err := fmt.Errorf("%w: chunk of %d bytes is past size of %d bytes", ErrCorrupt, size, c.h.size)
+		return decodeError(err, c.offset*8, c.n)
+	}
+
+	length, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return decodeError(err, c.offset*8, c.n)
+	}
+	if length > size {
+		err := fmt.Errorf("%w: chunk of %d bytes is coded with %d bytes", ErrCorrupt, size, length)
+		return decodeError(err, c.offset*8, c.n)
+	}
+	c.offset += uvarintLen(length)
+	if err := checkLimit(c.opts, c.n+size, c.offset+length); err != nil {
+		return decodeError(err, c.offset*8, c.n)
+	}
+	c.left, c.length = size, length
+
+	if length == size {
+		c.m = nil
+		return nil
+	}
+	if c.m == nil {
+		m, err := c.h.newModel(c.opts)
+		if err != nil {
+			return err
+		}
+		c.m = timed(m, c.opts)
+	}
+	if c.dec, err = newDecoder(c.r, c.opts, int64(length)); err != nil {
+		return decodeError(err, c.offset*8, c.n)
+	}
+	return nil
+}
+
+// readStored copies data of stored chunk into p
+func (c *chunkReader) readStored(p []byte) (int, error) {
+	n, err := io.ReadFull(c.r, p)
+	c.offset += uint64(n)
+	c.left -= uint64(n)
+	c.n += uint64(n)
+	if err != nil {
+		return n, decodeError(err, c.offset*8, c.n)
+	}
+	return n, nil
+}
+
+// decode decodes symbols of coded chunk into p, and checks that the chunk ends after the last of them
+func (c *chunkReader) decode(p []byte) (int, error) {
+	stop := measure(c.m)
+	for i := range p {
+		symbol, err := c.m.DecodeSymbol(c.dec)
+		if err == nil && symbol >= table.ABCSize {
+			err = fmt.Errorf("%w: invalid symbol %d", ErrCorrupt, symbol)
+		}
+		if err != nil {
+			return i, decodeError(err, c.position(), c.n)
+		}
+		p[i] = byte(symbol)
+		c.n++
+	}
+	stop()
+
+	c.left -= uint64(len(p))
+	if c.left == 0 {
+		if err := c.dec.finish(); err != nil {
+			return len(p), decodeError(err, c.position(), c.n)
+		}
+		c.offset += c.length
+		c.dec = nil
+	}
+	return len(p), nil
+}
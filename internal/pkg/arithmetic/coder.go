@@ -0,0 +1,422 @@
+package arithmetic
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/model"
+	"github.com/icza/bitio"
+)
+
+// errOverrun is returned when decoder needs more bits than there are in coded data
+var errOverrun = errors.New("arithmetic: decoder overruns coded data")
+
+// bounds holds interval delimiters
+type bounds struct {
+	bits       uint8
+	maxTotal   uint64 // maximum of sum of frequencies
+	maxBits    uint64 // maximum of total of bit probabilities, which doesn't overflow interval
+	top        uint64
+	firstQuart uint64
+	half       uint64
+	thirdQuart uint64
+}
+
+func newBounds(opts config.Options) bounds {
+	b := bounds{bits: opts.IntervalBitsUsed}
+	b.maxTotal = (1 << opts.CountBitsUsed) - 1
+	b.maxBits = (1 << (64 - b.bits)) - 1
+	b.top = (1 << b.bits) - 1
+	b.firstQuart = (b.top + 1) / 4
+	b.half = b.firstQuart * 2
+	b.thirdQuart = b.firstQuart * 3
+	return b
+}
+
+// settled returns number of leading bits on which l and h agree, so they can't change anymore
+func (b bounds) settled(l, h uint64) uint8 {
+	n := uint8(bits.LeadingZeros64((l ^ h) << (64 - b.bits)))
+	if n > b.bits {
+		return b.bits
+	}
+	return n
+}
+
+// straddling returns number of times interval [l, h] lies in the middle half, and is expanded.
+// Every expansion removes the second bit of l, which is 1, and of h, which is 0.
+// The first bit of l has to be 0, and of h has to be 1.
+func (b bounds) straddling(l, h uint64) uint8 {
+	shift := 65 - b.bits
+	n := bits.LeadingZeros64(^(l << shift))
+	if m := bits.LeadingZeros64(h<<shift | (1<<shift - 1)); m < n {
+		n = m
+	}
+	return uint8(n)
+}
+
+// normalized returns number of bits interval [l, h] is shifted by, as its settled bits are shifted out,
+// and it is expanded while it lies in the middle half.
+// Expanded bits follow the first bit on which l and h differ, and they are 1 in l and 0 in h.
+func (b bounds) normalized(l, h uint64) uint8 {
+	n := b.settled(l, h)
+	m := bits.LeadingZeros64(^((l &^ h) << (65 - b.bits + n)))
+	return n + uint8(m)
+}
+
+// shift removes n leading bits of v, and appends n bits of in
+func (b bounds) shift(v uint64, n uint8, in uint64) uint64 {
+	return (v<<n | in) & b.top
+}
+
+// expand removes n bits following the first one of v, and appends n bits of in
+func (b bounds) expand(v uint64, n uint8, in uint64) uint64 {
+	return v&b.half | (v<<n|in)&(b.half-1)
+}
+
+// encoder narrows interval and writes out its settled bits.
+// Bits are collected in 64-bit accumulator, and written out in bulk.
+type encoder struct {
+	bounds
+	w            *bitio.Writer
+	acc          uint64 // the last n bits are pending
+	n            uint8
+	buf          [8]byte
+	l            uint64
+	h            uint64
+	bitsToFollow uint64
+}
+
+func newEncoder(w *bitio.Writer, opts config.Options) *encoder {
+	b := newBounds(opts)
+	return &encoder{bounds: b, w: w, h: b.top}
+}
+
+// writeBits writes the last n bits of v, n is at most 56
+func (e *encoder) writeBits(v uint64, n uint8) error {
+	if e.n+n > 64 {
+		if err := e.spill(); err != nil {
+			return err
+		}
+	}
+	e.acc = e.acc<<n | v
+	e.n += n
+	return nil
+}
+
+// spill writes whole bytes of pending bits out to bit writer, so less than a byte is left pending
+func (e *encoder) spill() error {
+	binary.BigEndian.PutUint64(e.buf[:], e.acc<<(64-e.n))
+	_, err := e.w.Write(e.buf[:e.n/8])
+	e.n %= 8
+	e.acc &= 1<<e.n - 1
+	return err
+}
+
+// writeRun writes n copies of bit
+func (e *encoder) writeRun(bit uint64, n uint64) error {
+	for n > 0 {
+		k := uint8(32)
+		if n < 32 {
+			k = uint8(n)
+		}
+		if err := e.writeBits(-bit&(1<<k-1), k); err != nil {
+			return err
+		}
+		n -= uint64(k)
+	}
+	return nil
+}
+
+// bitsPlusFollow writes bit, followed by opposite bits pending from expansions of interval
+func (e *encoder) bitsPlusFollow(bit uint64) error {
+	if err := e.writeBits(bit, 1); err != nil {
+		return err
+	}
+	err := e.writeRun(bit^1, e.bitsToFollow)
+	e.bitsToFollow = 0
+	return err
+}
+
+// encode narrows interval to [low, high) out of total
+func (e *encoder) encode(low, high, total uint64) error {
+	delta := e.h - e.l + 1
+	e.h = e.l + high*delta/total - 1
+	e.l = e.l + low*delta/total
+
+	// Settled bits are written out at once: the first one is followed by pending bits
+	if n := e.settled(e.l, e.h); n > 0 {
+		settled := e.l >> (e.bits - n)
+		if f := e.bitsToFollow; f+uint64(n) <= 56 {
+			// Pending bits are inserted after the first bit, so everything is written by one call
+			bit := settled >> (n - 1)
+			run := -(bit ^ 1) & (1<<f - 1)
+			v := bit<<(f+uint64(n)-1) | run<<(n-1) | settled&(1<<(n-1)-1)
+			if err := e.writeBits(v, n+uint8(f)); err != nil {
+				return err
+			}
+			e.bitsToFollow = 0
+		} else {
+			if err := e.bitsPlusFollow(settled >> (n - 1)); err != nil {
+				return err
+			}
+			if err := e.writeBits(settled&(1<<(n-1)-1), n-1); err != nil {
+				return err
+			}
+		}
+		e.l = e.shift(e.l, n, 0)
+		e.h = e.shift(e.h, n, 1<<n-1)
+	}
+
+	if e.l >= e.firstQuart && e.h < e.thirdQuart {
+		n := e.straddling(e.l, e.h)
+		e.bitsToFollow += uint64(n)
+		e.l = e.expand(e.l, n, 0)
+		e.h = e.expand(e.h, n, 1<<n-1)
+	}
+	return nil
+}
+
+// Encode narrows interval to [low, high) out of total, checking that interval is valid
+func (e *encoder) Encode(low, high, total uint64) error {
+	if low >= high || high > total || total > e.maxTotal {
+		return fmt.Errorf("%w: interval [%d, %d) out of %d", ErrModel, low, high, total)
+	}
+	return e.encode(low, high, total)
+}
+
+// EncodeBit narrows interval according to probability of bit, and updates the probability
+func (e *encoder) EncodeBit(p *model.Prob, bit int) error {
+	low, high, total := p.Interval(bit)
+	if total > e.maxBits {
+		return fmt.Errorf("%w: total of bit probabilities %d is too large for %d interval bits", ErrModel, total, e.bits)
+	}
+	if err := e.encode(low, high, total); err != nil {
+		return err
+	}
+
+	p.Update(bit)
+	return nil
+}
+
+// finish writes out last interval. Bit writer still has to be closed afterwards.
+func (e *encoder) finish() error {
+	// Encode last interval
+	e.bitsToFollow += 1
+	bit := uint64(1)
+	if e.l < e.firstQuart {
+		bit = 0
+	}
+	if err := e.bitsPlusFollow(bit); err != nil {
+		return err
+	}
+
+	// Write full interval
+	if err := e.writeBits(e.l, e.bits); err != nil {
+		return err
+	}
+	if err := e.spill(); err != nil {
+		return err
+	}
+	return e.w.WriteBits(e.acc, e.n)
+}
+
+// decoder follows intervals narrowed by encoder.
+// Coded data of known length is read ahead by chunks, and bits are taken from them into 64-bit accumulator by whole words.
+// If length is unknown, data is read by whole bytes, so less than a byte is read ahead.
+type decoder struct {
+	bounds
+	r    *bitio.Reader
+	buf  [512]byte
+	in   []byte // bytes of buf, which aren't taken into accumulator yet
+	acc  uint64 // the last n bits are read, but not consumed yet
+	n    uint8
+	l    uint64
+	h    uint64
+	code uint64 // value read from stream minus l, so it lies in [0, h-l]
+	freq uint64 // the last value returned by Target
+	read uint64 // number of bytes taken into accumulator
+	left int64  // number of bytes of coded data left to read, or -1 if it is unknown
+}
+
+// newDecoder returns decoder of length bytes of coded data read from r.
+// If length is negative, it is unknown, and ends of data are reported as io.EOF.
+func newDecoder(r *bitio.Reader, opts config.Options, length int64) (*decoder, error) {
+	b := newBounds(opts)
+	d := &decoder{bounds: b, r: r, h: b.top, left: length}
+	code, err := d.readBits(b.bits)
+	if err != nil {
+		return nil, err
+	}
+	d.code = code
+	return d, nil
+}
+
+// position returns number of bits consumed
+func (d *decoder) position() uint64 {
+	return d.read*8 - uint64(d.n)
+}
+
+// readBits returns the next n bits, n is at most 56
+func (d *decoder) readBits(n uint8) (uint64, error) {
+	if d.n < n {
+		if err := d.fill(n); err != nil {
+			return 0, err
+		}
+	}
+	d.n -= n
+	return d.acc >> d.n & (1<<n - 1), nil
+}
+
+// fill takes whole bytes into accumulator until at least n bits aren't consumed.
+// If stream ends, bits left are consumed, as if they were read one by one.
+func (d *decoder) fill(n uint8) error {
+	for d.n < n {
+		if len(d.in) == 0 {
+			if err := d.next(n); err != nil {
+				d.n = 0
+				return err
+			}
+		}
+		if len(d.in) >= 8 {
+			k := (64 - d.n) / 8
+			d.acc = d.acc<<(8*k) | binary.BigEndian.Uint64(d.in)>>(64-8*k)
+			d.in = d.in[k:]
+			d.n += 8 * k
+			d.read += uint64(k)
+		} else {
+			d.acc = d.acc<<8 | uint64(d.in[0])
+			d.in = d.in[1:]
+			d.n += 8
+			d.read++
+		}
+	}
+	return nil
+}
+
+// next reads the next chunk of coded data, so that n bits aren't consumed once it is taken.
+// Reading past the known length of coded data means it is corrupted, rather than truncated.
+func (d *decoder) next(n uint8) error {
+	if d.left == 0 {
+		return fmt.Errorf("%w: %v", ErrCorrupt, errOverrun)
+	}
+
+	// Bytes following coded data of unknown length belong to the rest of stream, so they are left unread
+	k := int64(len(d.buf))
+	if d.left < 0 {
+		k = int64(n-d.n+7) / 8
+	} else if k > d.left {
+		k = d.left
+	}
+	m, err := io.ReadFull(d.r, d.buf[:k])
+	d.in = d.buf[:m]
+	if d.left > 0 {
+		d.left -= int64(m)
+	}
+	if m == 0 {
+		return err
+	}
+	return nil
+}
+
+// finish skips the rest of encoder output. Only whole bytes are read, so the next read starts at byte boundary following it.
+func (d *decoder) finish() error {
+	// Encoder wrote out two bits more than decoder reads: the last interval bit and one more following it
+	if _, err := d.readBits(2); err != nil {
+		return err
+	}
+	left := int64(d.n/8) + int64(len(d.in))
+	if d.left > 0 {
+		left += d.left
+	}
+	d.n = 0
+	if left > 0 {
+		return fmt.Errorf("%w: %d bytes of coded data are left after decoding", ErrCorrupt, left)
+	}
+	return nil
+}
+
+// target returns frequency out of total which lies in interval of next symbol
+func (d *decoder) target(total uint64) uint64 {
+	delta := d.h - d.l + 1
+	return ((d.code+1)*total - 1) / delta
+}
+
+// Target returns frequency out of total which lies in interval of next symbol.
+// Total depends on data decoded so far, e.g. on counts of static model or escapes of PPM,
+// so invalid total means data is corrupted, since encoder accepted it.
+func (d *decoder) Target(total uint64) (uint64, error) {
+	if total == 0 || total > d.maxTotal {
+		return 0, fmt.Errorf("%w: total is %d", ErrCorrupt, total)
+	}
+
+	d.freq = d.target(total)
+	if d.freq >= total {
+		return 0, ErrCorrupt
+	}
+	return d.freq, nil
+}
+
+// Decode narrows interval to [low, high) out of total, checking that it contains frequency returned by Target
+func (d *decoder) Decode(low, high, total uint64) error {
+	if d.freq < low || d.freq >= high || high > total {
+		return fmt.Errorf("%w: interval [%d, %d) out of %d doesn't contain %d", ErrModel, low, high, total, d.freq)
+	}
+	return d.consume(low, high, total)
+}
+
+// DecodeBit returns bit encoded by EncodeBit, and updates its probability the same way
+func (d *decoder) DecodeBit(p *model.Prob) (int, error) {
+	_, _, total := p.Interval(0)
+	if total > d.maxBits {
+		return 0, fmt.Errorf("%w: total of bit probabilities %d is too large for %d interval bits", ErrModel, total, d.bits)
+	}
+	bit := p.Bit(d.target(total))
+	low, high, total := p.Interval(bit)
+	if err := d.consume(low, high, total); err != nil {
+		return 0, err
+	}
+
+	p.Update(bit)
+	return bit, nil
+}
+
+// consume narrows interval to [low, high) out of total, the same way encoder did
+func (d *decoder) consume(low, high, total uint64) error {
+	delta := d.h - d.l + 1
+	lo, hi := low*delta/total, high*delta/total
+
+	// Value lies in interval of frequency returned by target, even if stream is corrupted, so it can't overflow
+	d.code -= lo
+	d.h = d.l + hi - 1
+	d.l = d.l + lo
+
+	// Settling and expansion of interval keep value relative to l, and only shift new bits into it.
+	// Afterwards the first bit of l is 0, and of h is 1, and the rest are shifted.
+	n := d.normalized(d.l, d.h)
+	d.l = d.l << n & (d.half - 1)
+	d.h = d.half | (d.h<<n|(1<<n-1))&(d.half-1)
+
+	// Only interval of more than 56 bits may need more bits than one read gives
+	for n > 56 {
+		in, err := d.readBits(56)
+		if err != nil {
+			return err
+		}
+		d.code = d.code<<56 | in
+		n -= 56
+	}
+
+	// The same as readBits, which is too large to be inlined
+	if d.n < n {
+		if err := d.fill(n); err != nil {
+			return err
+		}
+	}
+	d.n -= n
+	d.code = d.code<<n | d.acc>>d.n&(1<<n-1)
+	return nil
+}
@@ -0,0 +1,471 @@
+package arithmetic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/model"
+	"github.com/cravtos/arithmetic/internal/pkg/ppm"
+	"github.com/cravtos/arithmetic/internal/pkg/table"
+	"github.com/icza/bitio"
+)
+
+// Header layout:
+//
+//	magic              4 bytes  "ARIT"
+//	version            1 byte
+//	flags              1 byte
+//	model              1 byte
+//	IntervalBitsUsed   1 byte
+//	CountBitsUsed      1 byte
+//	CountDenominator   1 byte
+//	UpdateRangesRate   uvarint
+//	size               uvarint, only if neither flagEOF nor flagBlocks is set
+//	length             uvarint  number of bytes of coded data, only if flagLength is set
+//	BlockSize          uvarint, only if flagBlocks is set
+//	PPMOrder           1 byte, only for config.ModelPPM
+//	PPMMemory          uvarint, only for config.ModelPPM
+//	meta fields        1 byte, only if flagMeta is set
+//	name length        uvarint, only if metaName is set
+//	name               name length bytes, only if metaName is set
+//	mtime              varint   modification time in Unix nanoseconds, only if metaMTime is set
+//	mode               uvarint  permission bits, only if metaMode is set
+//
+// Header is followed by coded data, aligned to byte boundary, and then by trailer.
+// If flagStored is set, header is followed by size bytes of original data instead.
+// If flagBlocks is set, coded data is a sequence of blocks, terminated by a zero size:
+//
+//	size               uvarint  number of original bytes in block, at most BlockSize
+//	length             uvarint  number of coded bytes in block, equal to size if block is stored as is
+//	data               length bytes
+//
+// If flagChunks is set, coded data is a sequence of chunks framed the same way as blocks.
+// Chunks are coded one after another with one model, which starts anew after chunk stored as is.
+//
+// If flagIndex is set, blocks are followed by index of them, so any block can be found from the end of stream:
+//
+//	count              uvarint  number of blocks
+//	offset             uvarint  position of coded block data in stream, for every block
+//	size               uvarint  number of original bytes in block, for every block
+//	length             uvarint  number of coded bytes in block, for every block
+//	checksum           4 bytes  CRC-32C of original bytes in block, for every block
+//	index length       4 bytes  number of bytes in index up to this field
+//
+// Trailer:
+//
+//	checksum           4 bytes  CRC-32C of original data, only if flagChecksum is set
+
+// magic begins every compressed stream
+var magic = []byte("ARIT")
+
+// version of the stream format
+const version = 2
+
+// modelCustom is recorded in header instead of config.ModelKind when model is given in config.Options
+const modelCustom = 255
+
+// Header flags
+const (
+	// flagEOF is set when stream is terminated by EOF symbol, or by zero size of chunk, instead of having size in header
+	flagEOF = 1 << iota
+	// flagChecksum is set when stream is followed by CRC-32C of original data
+	flagChecksum
+	// flagBlocks is set when data is split into independently coded blocks
+	flagBlocks
+	// flagIndex is set when blocks are followed by index of them
+	flagIndex
+	// flagStored is set when data is stored as is, since coding doesn't make it smaller
+	flagStored
+	// flagMeta is set when header holds information about original file
+	flagMeta
+	// flagLength is set when header holds length of coded data, so decoder reading past it is told from truncated stream
+	flagLength
+	// flagChunks is set when data is split into chunks, which are coded with one model, or stored as is
+	flagChunks
+
+	knownFlags = flagEOF | flagChecksum | flagBlocks | flagIndex | flagStored | flagMeta | flagLength | flagChunks
+)
+
+// Meta fields, which are present in header
+const (
+	// metaName is set when header holds name of original file
+	metaName = 1 << iota
+	// metaMTime is set when header holds modification time of original file
+	metaMTime
+	// metaMode is set when header holds permissions of original file
+	metaMode
+
+	knownMeta = metaName | metaMTime | metaMode
+)
+
+var (
+	// ErrHeader is returned when stream doesn't begin with valid header
+	ErrHeader = errors.New("arithmetic: invalid header")
+	// ErrUnsupportedVersion is returned when stream format version is unknown
+	ErrUnsupportedVersion = errors.New("arithmetic: unsupported format version")
+	// ErrParameters is returned when coder parameters are invalid
+	ErrParameters = errors.New("arithmetic: invalid coder parameters")
+	// ErrChecksum is returned when decoded data doesn't match checksum stored in stream
+	ErrChecksum = errors.New("arithmetic: checksum mismatch")
+	// ErrModel is returned when model gives invalid intervals, or stream needs model which isn't given
+	ErrModel = errors.New("arithmetic: invalid model")
+
+	// ErrCorrupt is returned when coded data can't be produced by encoder
+	ErrCorrupt = model.ErrCorrupt
+	// ErrTruncated is returned when stream ends before all data is decoded
+	ErrTruncated = errors.New("arithmetic: truncated stream")
+	// ErrLimit is returned when decoded data exceeds config.Options.MaxOutput or config.Options.MaxRatio
+	ErrLimit = errors.New("arithmetic: output limit exceeded")
+)
+
+// DecodeError describes failure of decoding, and position in stream where it happened
+type DecodeError struct {
+	Err    error // ErrCorrupt, ErrTruncated, ErrChecksum, ErrModel, ErrLimit or error of underlying reader
+	Offset int64 // number of bits of compressed stream read before failure
+	Symbol int64 // index of symbol being decoded, which is the number of bytes decoded before failure
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v at bit %d of compressed stream, symbol %d", e.Err, e.Offset, e.Symbol)
+}
+
+// Unwrap returns the cause of failure, so errors.Is(err, ErrCorrupt) works on DecodeError
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeError returns DecodeError of err, which happened at offset bits of stream while decoding symbol.
+// Ends of data are reported as ErrTruncated. DecodeError is returned as is.
+func decodeError(err error, offset uint64, symbol uint64) error {
+	var de *DecodeError
+	if errors.As(err, &de) {
+		return err
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	return &DecodeError{Err: err, Offset: int64(offset), Symbol: int64(symbol)}
+}
+
+// maxNameLen is the maximal length of file name in header
+const maxNameLen = 4096
+
+// Meta holds optional information about original file, which is recorded in header like in gzip
+type Meta struct {
+	Name    string    // base name of the file, empty if unknown
+	ModTime time.Time // zero if unknown
+	Mode    fs.FileMode
+}
+
+// crcTable is used for checksum of original data
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// header holds information needed to decode stream
+type header struct {
+	version          byte
+	flags            byte
+	model            byte
+	intervalBitsUsed byte
+	countBitsUsed    byte
+	countDenominator byte
+	updateRangesRate uint64
+	size             uint64
+	coded            uint64 // number of bytes of coded data, if flagLength is set
+	blockSize        uint64
+	ppmOrder         byte
+	ppmMemory        uint64
+	metaFields       byte
+	meta             Meta
+}
+
+// setMeta records m in header, marking fields which are known
+func (h *header) setMeta(m Meta) {
+	h.meta = m
+	h.metaFields = 0
+	if m.Name != "" {
+		h.metaFields |= metaName
+	}
+	if !m.ModTime.IsZero() {
+		h.metaFields |= metaMTime
+	}
+	if m.Mode != 0 {
+		h.metaFields |= metaMode
+	}
+
+	h.flags &^= flagMeta
+	if h.metaFields != 0 {
+		h.flags |= flagMeta
+	}
+}
+
+// newHeader returns header with current version and given parameters
+func newHeader(opts config.Options) header {
+	model := byte(opts.ModelKind)
+	if opts.Custom() {
+		model = modelCustom
+	}
+
+	return header{
+		version:          version,
+		model:            model,
+		intervalBitsUsed: opts.IntervalBitsUsed,
+		countBitsUsed:    opts.CountBitsUsed,
+		countDenominator: opts.CountDenominator,
+		updateRangesRate: opts.UpdateRangesRate,
+		blockSize:        opts.BlockSize,
+		ppmOrder:         opts.PPMOrder,
+		ppmMemory:        opts.PPMMemory,
+	}
+}
+
+// options returns parameters stream was encoded with.
+// Custom model, and options which aren't recorded in stream, are taken from opts.
+func (h header) options(opts config.Options) config.Options {
+	o := config.Options{
+		IntervalBitsUsed: h.intervalBitsUsed,
+		CountDenominator: h.countDenominator,
+		CountBitsUsed:    h.countBitsUsed,
+		UpdateRangesRate: h.updateRangesRate,
+		PPMOrder:         h.ppmOrder,
+		PPMMemory:        h.ppmMemory,
+		BlockSize:        h.blockSize,
+		Seekable:         h.flags&flagIndex != 0,
+		Workers:          opts.Workers,
+		MaxOutput:        opts.MaxOutput,
+		MaxRatio:         opts.MaxRatio,
+		Timings:          opts.Timings,
+	}
+	if h.model == modelCustom {
+		o.Model, o.Coder = opts.Model, opts.Coder
+	} else {
+		o.ModelKind = config.ModelKind(h.model)
+	}
+	return o
+}
+
+// Info describes stream as recorded in its header
+type Info struct {
+	Version  int
+	Options  config.Options // coder parameters, ModelKind is meaningless if Custom is set
+	Custom   bool           // stream is coded with custom model, which has to be given to decoder
+	Size     int64          // number of bytes of original data, or -1 if it isn't recorded in header
+	Stored   bool           // data is stored as is
+	Checksum bool           // stream ends with CRC-32C of original data
+	Meta     Meta
+	Length   int64 // number of bytes in header
+}
+
+// info returns description of stream with header h
+func (h header) info() Info {
+	i := Info{
+		Version:  int(h.version),
+		Options:  h.options(config.Options{}),
+		Custom:   h.model == modelCustom,
+		Size:     -1,
+		Stored:   h.flags&flagStored != 0,
+		Checksum: h.flags&flagChecksum != 0,
+		Meta:     h.meta,
+		Length:   int64(h.length()),
+	}
+	if h.flags&(flagEOF|flagBlocks) == 0 {
+		i.Size = int64(h.size)
+	}
+	return i
+}
+
+// newModel constructs model stream is coded with
+func (h header) newModel(opts config.Options) (model.Coder, error) {
+	symbols := table.ABCSize
+	if h.flags&(flagEOF|flagChunks) == flagEOF {
+		symbols = table.ABCSize + 1
+	}
+
+	if h.model == modelCustom {
+		if opts.Coder != nil {
+			return opts.Coder(symbols), nil
+		}
+		if opts.Model == nil {
+			return nil, fmt.Errorf("%w: stream is coded with custom model, which isn't given", ErrModel)
+		}
+		return model.NewCoder(opts.Model(symbols)), nil
+	}
+
+	switch opts.ModelKind {
+	case config.ModelFenwick:
+		return model.NewCoder(table.NewFenwick(symbols, opts)), nil
+	case config.ModelOrder1:
+		return model.NewCoder(table.NewContext(1, symbols, opts)), nil
+	case config.ModelOrder2:
+		return model.NewCoder(table.NewContext(2, symbols, opts)), nil
+	case config.ModelPPM:
+		return ppm.New(symbols, opts), nil
+	case config.ModelBinary:
+		return model.NewBinary(symbols), nil
+	case config.ModelStatic:
+		return table.NewStatic(symbols, opts), nil
+	default:
+		return model.NewCoder(table.New(symbols, opts)), nil
+	}
+}
+
+// length returns number of bytes in header
+func (h header) length() uint64 {
+	n, _ := h.write(io.Discard)
+	return uint64(n)
+}
+
+func (h header) write(w io.Writer) (int, error) {
+	buf := &bytes.Buffer{}
+	buf.Write(magic)
+	buf.Write([]byte{h.version, h.flags, h.model, h.intervalBitsUsed, h.countBitsUsed, h.countDenominator})
+
+	varint := make([]byte, binary.MaxVarintLen64)
+	buf.Write(varint[:binary.PutUvarint(varint, h.updateRangesRate)])
+	if h.flags&(flagEOF|flagBlocks) == 0 {
+		buf.Write(varint[:binary.PutUvarint(varint, h.size)])
+	}
+	if h.flags&flagLength != 0 {
+		buf.Write(varint[:binary.PutUvarint(varint, h.coded)])
+	}
+	if h.flags&flagBlocks != 0 {
+		buf.Write(varint[:binary.PutUvarint(varint, h.blockSize)])
+	}
+	if h.model == byte(config.ModelPPM) {
+		buf.WriteByte(h.ppmOrder)
+		buf.Write(varint[:binary.PutUvarint(varint, h.ppmMemory)])
+	}
+	if h.flags&flagMeta != 0 {
+		buf.WriteByte(h.metaFields)
+	}
+	if h.metaFields&metaName != 0 {
+		buf.Write(varint[:binary.PutUvarint(varint, uint64(len(h.meta.Name)))])
+		buf.WriteString(h.meta.Name)
+	}
+	if h.metaFields&metaMTime != 0 {
+		buf.Write(varint[:binary.PutVarint(varint, h.meta.ModTime.UnixNano())])
+	}
+	if h.metaFields&metaMode != 0 {
+		buf.Write(varint[:binary.PutUvarint(varint, uint64(h.meta.Mode.Perm()))])
+	}
+
+	return w.Write(buf.Bytes())
+}
+
+func readHeader(r *bitio.Reader) (h header, err error) {
+	fixed := make([]byte, len(magic)+6)
+	if _, err = io.ReadFull(r, fixed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return h, fmt.Errorf("%w: too short", ErrHeader)
+		}
+		return h, err
+	}
+	if !bytes.Equal(fixed[:len(magic)], magic) {
+		return h, fmt.Errorf("%w: bad magic bytes", ErrHeader)
+	}
+
+	fixed = fixed[len(magic):]
+	h.version, h.flags, h.model = fixed[0], fixed[1], fixed[2]
+	h.intervalBitsUsed, h.countBitsUsed, h.countDenominator = fixed[3], fixed[4], fixed[5]
+
+	if h.version != version {
+		return h, fmt.Errorf("%w %d", ErrUnsupportedVersion, h.version)
+	}
+	if h.flags&^knownFlags != 0 {
+		return h, fmt.Errorf("%w: unknown flags %#x", ErrHeader, h.flags)
+	}
+	if h.model != modelCustom && !config.ModelKind(h.model).Known() {
+		return h, fmt.Errorf("%w: unknown model %d", ErrHeader, h.model)
+	}
+
+	if h.updateRangesRate, err = binary.ReadUvarint(r); err != nil {
+		return h, fmt.Errorf("%w: %v", ErrHeader, err)
+	}
+	if h.flags&(flagEOF|flagBlocks) == 0 {
+		if h.size, err = binary.ReadUvarint(r); err != nil {
+			return h, fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+	}
+	if h.flags&flagLength != 0 {
+		if h.flags&(flagBlocks|flagStored) != 0 {
+			return h, fmt.Errorf("%w: length of coded data with blocks or stored data", ErrHeader)
+		}
+		if h.coded, err = binary.ReadUvarint(r); err != nil {
+			return h, fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+		if int64(h.coded) < 0 {
+			return h, fmt.Errorf("%w: invalid length of coded data %d", ErrHeader, h.coded)
+		}
+	}
+	if h.flags&flagBlocks != 0 {
+		if h.blockSize, err = binary.ReadUvarint(r); err != nil {
+			return h, fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+		if h.blockSize == 0 {
+			return h, fmt.Errorf("%w: zero block size", ErrHeader)
+		}
+	} else if h.flags&flagIndex != 0 {
+		return h, fmt.Errorf("%w: index without blocks", ErrHeader)
+	}
+	if h.flags&flagStored != 0 && h.flags&(flagEOF|flagBlocks) != 0 {
+		return h, fmt.Errorf("%w: stored data without size", ErrHeader)
+	}
+	if h.flags&flagChunks != 0 && h.flags&(flagBlocks|flagStored|flagLength) != 0 {
+		return h, fmt.Errorf("%w: chunks with blocks, stored data or length of coded data", ErrHeader)
+	}
+	if h.model == byte(config.ModelPPM) {
+		if h.ppmOrder, err = r.ReadByte(); err != nil {
+			return h, fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+		if h.ppmMemory, err = binary.ReadUvarint(r); err != nil {
+			return h, fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+	}
+	if h.flags&flagMeta != 0 {
+		if h.metaFields, err = r.ReadByte(); err != nil {
+			return h, fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+		if h.metaFields&^knownMeta != 0 {
+			return h, fmt.Errorf("%w: unknown meta fields %#x", ErrHeader, h.metaFields)
+		}
+	}
+	if h.metaFields&metaName != 0 {
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return h, fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+		if length == 0 || length > maxNameLen {
+			return h, fmt.Errorf("%w: invalid name length %d", ErrHeader, length)
+		}
+		name := make([]byte, length)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return h, fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+		h.meta.Name = string(name)
+	}
+	if h.metaFields&metaMTime != 0 {
+		mtime, err := binary.ReadVarint(r)
+		if err != nil {
+			return h, fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+		h.meta.ModTime = time.Unix(0, mtime)
+	}
+	if h.metaFields&metaMode != 0 {
+		mode, err := binary.ReadUvarint(r)
+		if err != nil {
+			return h, fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+		h.meta.Mode = fs.FileMode(mode) & fs.ModePerm
+	}
+
+	if err := h.options(config.Options{}).Validate(); err != nil {
+		return h, fmt.Errorf("%w: %v", ErrParameters, err)
+	}
+	return h, nil
+}
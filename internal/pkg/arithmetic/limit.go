@@ -0,0 +1,35 @@
+package arithmetic
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+)
+
+// ratioSlack is number of decoded bytes, which aren't limited by config.Options.MaxRatio
+const ratioSlack = 1 << 20
+
+// limit returns number of bytes, which may be decoded after read bytes of stream are read
+func limit(opts config.Options, read uint64) uint64 {
+	max := uint64(math.MaxUint64)
+	if opts.MaxOutput != 0 {
+		max = opts.MaxOutput
+	}
+	if opts.MaxRatio != 0 && max > ratioSlack && read <= (max-ratioSlack)/opts.MaxRatio {
+		max = read*opts.MaxRatio + ratioSlack
+	}
+	return max
+}
+
+// checkLimit returns ErrLimit if n decoded bytes exceed limits after read bytes of stream are read
+func checkLimit(opts config.Options, n, read uint64) error {
+	switch {
+	case n <= limit(opts, read):
+		return nil
+	case opts.MaxOutput != 0 && n > opts.MaxOutput:
+		return fmt.Errorf("%w: output is larger than %d bytes", ErrLimit, opts.MaxOutput)
+	default:
+		return fmt.Errorf("%w: output is more than %d times larger than input", ErrLimit, opts.MaxRatio)
+	}
+}
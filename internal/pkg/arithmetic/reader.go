@@ -0,0 +1,295 @@
+package arithmetic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/model"
+	"github.com/cravtos/arithmetic/internal/pkg/table"
+	"github.com/cravtos/arithmetic/internal/pkg/timing"
+	"github.com/icza/bitio"
+)
+
+// Reader decompresses data read from underlying reader.
+type Reader struct {
+	r    *bitio.Reader
+	dec  *decoder
+	m    model.Coder
+	opts config.Options
+
+	// eof is set when stream is terminated by table.EOF symbol
+	eof  bool
+	size uint64 // number of bytes in stream
+	n    uint64 // number of bytes decoded
+
+	// limit is number of bytes, which may be decoded before limits are checked again
+	limit uint64
+
+	// stored is set when data is stored as is
+	stored bool
+
+	// chunks is set when data is coded in chunks with one model
+	chunks *chunkReader
+
+	// blocks is set when data is split into independently coded blocks.
+	// Decoded data of the current block, which isn't read yet, is kept in block.
+	blocks *blockReader
+	block  []byte
+
+	meta Meta // information about original file from header
+
+	header uint64 // number of bytes in header
+
+	checksum bool   // set when stream has checksum trailer
+	crc      uint32 // checksum of bytes decoded
+
+	err error
+}
+
+// NewReader returns Reader decompressing from r. Header of the stream is read immediately.
+// Coder parameters are taken from the header, only custom model is taken from opts.
+func NewReader(r io.Reader, opts config.Options) (*Reader, error) {
+	z := &Reader{}
+	if err := z.Reset(r, opts); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// ReadInfo reads header of stream from r and returns description of the stream.
+// Unlike NewReader, it doesn't need custom model the stream is coded with.
+func ReadInfo(r io.Reader) (Info, error) {
+	h, err := readHeader(bitio.NewReader(r))
+	if err != nil {
+		return Info{}, err
+	}
+	return h.info(), nil
+}
+
+// Reset discards Reader state and makes it equivalent to NewReader(r, opts).
+func (z *Reader) Reset(r io.Reader, opts config.Options) error {
+	if opts.Timings != nil {
+		r = timing.Reader(r, opts.Timings)
+	}
+	*z = Reader{r: bitio.NewReader(r)}
+
+	h, err := readHeader(z.r)
+	if err != nil {
+		z.err = err
+		return err
+	}
+	z.opts = h.options(opts)
+	z.checksum = h.flags&flagChecksum != 0
+	z.eof = h.flags&flagEOF != 0
+	z.size = h.size
+	z.meta = h.meta
+	z.header = h.length()
+	z.limit = limit(z.opts, z.header)
+	if h.flags&flagBlocks != 0 {
+		z.blocks = newBlockReader(z.r, h, z.opts)
+		return nil
+	}
+	if !z.eof && z.opts.MaxOutput != 0 && z.size > z.opts.MaxOutput {
+		err := fmt.Errorf("%w: output of %d bytes is larger than %d bytes", ErrLimit, z.size, z.opts.MaxOutput)
+		z.err = decodeError(err, z.header*8, 0)
+		return z.err
+	}
+	if h.flags&flagStored != 0 {
+		z.stored = true
+		return nil
+	}
+	if h.flags&flagChunks != 0 {
+		z.chunks, z.err = newChunkReader(z.r, h, z.opts)
+		return z.err
+	}
+	if z.m, z.err = h.newModel(z.opts); z.err != nil {
+		return z.err
+	}
+	z.m = timed(z.m, z.opts)
+
+	length := int64(-1)
+	if h.flags&flagLength != 0 {
+		length = int64(h.coded)
+	}
+	if z.dec, z.err = newDecoder(z.r, z.opts, length); z.err != nil {
+		z.err = decodeError(z.err, z.header*8, 0)
+	}
+	return z.err
+}
+
+// position returns number of bits read from stream
+func (z *Reader) position() uint64 {
+	switch {
+	case z.blocks != nil:
+		return z.blocks.offset * 8
+	case z.chunks != nil:
+		return z.chunks.position()
+	case z.stored:
+		return (z.header + z.n) * 8
+	default:
+		return z.header*8 + z.dec.position()
+	}
+}
+
+// Meta returns information about original file recorded in header.
+func (z *Reader) Meta() Meta {
+	return z.meta
+}
+
+// Read decompresses data into p.
+func (z *Reader) Read(p []byte) (n int, err error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+
+	if z.blocks != nil {
+		return z.readBlocks(p)
+	}
+	if z.chunks != nil {
+		return z.readChunks(p)
+	}
+	if z.stored {
+		return z.readStored(p)
+	}
+
+	end := false
+	stop := measure(z.m)
+	for n < len(p) {
+		if !z.eof && z.n == z.size {
+			end = true
+			break
+		}
+
+		var symbol int
+		if symbol, z.err = z.m.DecodeSymbol(z.dec); z.err != nil {
+			z.err = decodeError(z.err, z.position(), z.n)
+			break
+		}
+		if symbol == table.EOF {
+			end = true
+			break
+		}
+		if z.n == z.limit {
+			if z.err = z.checkLimit(); z.err != nil {
+				break
+			}
+		}
+		p[n] = byte(symbol)
+		n++
+		z.n++
+	}
+	stop()
+
+	z.crc = crc32.Update(z.crc, crcTable, p[:n])
+	if end {
+		z.err = z.readTrailer()
+	}
+
+	if n > 0 && z.err == io.EOF {
+		return n, nil
+	}
+	return n, z.err
+}
+
+// checkLimit updates number of bytes, which may be decoded, and returns ErrLimit if it is reached
+func (z *Reader) checkLimit() error {
+	read := z.position() / 8
+	z.limit = limit(z.opts, read)
+	if err := checkLimit(z.opts, z.n+1, read); err != nil {
+		return decodeError(err, z.position(), z.n)
+	}
+	return nil
+}
+
+// readStored copies data stored as is into p
+func (z *Reader) readStored(p []byte) (n int, err error) {
+	if uint64(len(p)) > z.size-z.n {
+		p = p[:z.size-z.n]
+	}
+	n, z.err = io.ReadFull(z.r, p)
+	z.n += uint64(n)
+	z.crc = crc32.Update(z.crc, crcTable, p[:n])
+	if z.err != nil {
+		z.err = decodeError(z.err, z.position(), z.n)
+	} else if z.n == z.size {
+		z.err = z.readTrailer()
+	}
+
+	if n > 0 && z.err == io.EOF {
+		return n, nil
+	}
+	return n, z.err
+}
+
+// readChunks decodes chunks into p
+func (z *Reader) readChunks(p []byte) (n int, err error) {
+	n, z.err = z.chunks.read(p)
+	z.n += uint64(n)
+
+	z.crc = crc32.Update(z.crc, crcTable, p[:n])
+	if z.err == io.EOF {
+		z.err = z.readTrailer()
+	}
+
+	if n > 0 && z.err == io.EOF {
+		return n, nil
+	}
+	return n, z.err
+}
+
+// readBlocks copies decoded blocks into p
+func (z *Reader) readBlocks(p []byte) (n int, err error) {
+	for n < len(p) {
+		if len(z.block) == 0 {
+			if z.block, z.err = z.blocks.next(); z.err != nil {
+				break
+			}
+		}
+		m := copy(p[n:], z.block)
+		z.block = z.block[m:]
+		n += m
+	}
+	z.n += uint64(n)
+
+	z.crc = crc32.Update(z.crc, crcTable, p[:n])
+	if z.err == io.EOF {
+		z.err = z.readTrailer()
+	}
+
+	if n > 0 && z.err == io.EOF {
+		return n, nil
+	}
+	return n, z.err
+}
+
+// readTrailer verifies checksum of decoded data. It returns io.EOF if everything is fine.
+func (z *Reader) readTrailer() error {
+	if z.dec != nil {
+		if err := z.dec.finish(); err != nil {
+			return decodeError(err, z.position(), z.n)
+		}
+	}
+	if !z.checksum {
+		return io.EOF
+	}
+
+	trailer := make([]byte, 4)
+	if _, err := io.ReadFull(z.r, trailer); err != nil {
+		return decodeError(err, z.position(), z.n)
+	}
+	if binary.BigEndian.Uint32(trailer) != z.crc {
+		return decodeError(ErrChecksum, z.position(), z.n)
+	}
+	return io.EOF
+}
+
+// Close does not close the underlying reader. It only returns error encountered while decoding, if any.
+func (z *Reader) Close() error {
+	if z.err == io.EOF {
+		return nil
+	}
+	return z.err
+}
@@ -0,0 +1,202 @@
+package arithmetic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/icza/bitio"
+)
+
+// SeekableReader gives random access to data of stream written with config.Options.Seekable.
+// Only blocks containing requested data are decoded. Checksum of every block is verified,
+// checksum of the whole stream is not.
+type SeekableReader struct {
+	r     io.ReaderAt
+	h     header
+	opts  config.Options
+	index []blockEntry
+	start []int64 // position of the first byte of every block in original data
+	size  int64   // number of bytes in original data
+
+	mu     sync.Mutex
+	cached int    // number of block kept in cache, or -1
+	cache  []byte // decoded data of cached block
+
+	pos int64 // position of Read
+}
+
+// NewSeekableReader returns SeekableReader of stream, which has size bytes in r.
+// Coder parameters are taken from the header, only custom model is taken from opts.
+func NewSeekableReader(r io.ReaderAt, size int64, opts config.Options) (*SeekableReader, error) {
+	z := &SeekableReader{r: r, cached: -1}
+
+	h, err := readHeader(bitio.NewReader(io.NewSectionReader(r, 0, size)))
+	if err != nil {
+		return nil, err
+	}
+	if h.flags&flagIndex == 0 {
+		return nil, fmt.Errorf("%w: stream has no index", ErrHeader)
+	}
+	z.h = h
+	z.opts = h.options(opts)
+	if _, err := h.newModel(z.opts); err != nil {
+		return nil, err
+	}
+
+	// Find index from the end of stream
+	end := size
+	if h.flags&flagChecksum != 0 {
+		end -= 4
+	}
+	end -= 4
+	if end < 0 {
+		return nil, ErrTruncated
+	}
+	fixed := make([]byte, 4)
+	if _, err := r.ReadAt(fixed, end); err != nil {
+		return nil, truncated(err)
+	}
+	length := int64(binary.BigEndian.Uint32(fixed))
+	if length > end {
+		return nil, fmt.Errorf("%w: index is longer than stream", ErrCorrupt)
+	}
+
+	data := make([]byte, length+4)
+	if _, err := r.ReadAt(data, end-length); err != nil {
+		return nil, truncated(err)
+	}
+	if z.index, err = readIndex(bytes.NewReader(data), h); err != nil {
+		return nil, err
+	}
+
+	// Blocks follow header one after another, each after its size and length, and are followed by zero size and index
+	z.start = make([]int64, len(z.index))
+	next, limit := h.length(), uint64(end-length)
+	for i, e := range z.index {
+		if e.length > limit || e.offset > limit-e.length {
+			return nil, fmt.Errorf("%w: block %d is out of stream", ErrCorrupt, i)
+		}
+		if e.offset != next+uvarintLen(e.size)+uvarintLen(e.length) {
+			return nil, fmt.Errorf("%w: block %d doesn't follow previous one", ErrCorrupt, i)
+		}
+		next = e.offset + e.length
+		if z.size > math.MaxInt64-int64(e.size) {
+			return nil, fmt.Errorf("%w: block %d is past maximal size", ErrCorrupt, i)
+		}
+		// Block is decoded as a whole, even if a byte of it is read
+		if err := checkLimit(z.opts, e.size, e.length); err != nil {
+			return nil, decodeError(err, e.offset*8, uint64(z.size))
+		}
+		z.start[i] = z.size
+		z.size += int64(e.size)
+	}
+	if next+1 != limit {
+		return nil, fmt.Errorf("%w: blocks don't end before index", ErrCorrupt)
+	}
+	if err := checkLimit(z.opts, uint64(z.size), uint64(size)); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// Size returns number of bytes in original data.
+func (z *SeekableReader) Size() int64 {
+	return z.size
+}
+
+// block returns decoded data of i-th block
+func (z *SeekableReader) block(i int) ([]byte, error) {
+	z.mu.Lock()
+	if z.cached == i {
+		data := z.cache
+		z.mu.Unlock()
+		return data, nil
+	}
+	z.mu.Unlock()
+
+	e, start := z.index[i], uint64(z.start[i])
+	coded := make([]byte, e.length)
+	if _, err := z.r.ReadAt(coded, int64(e.offset)); err != nil {
+		return nil, decodeError(err, e.offset*8, start)
+	}
+	data, err := decodeBlock(coded, e.size, z.h, z.opts, e.offset, start)
+	if err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(data, crcTable) != e.crc {
+		return nil, decodeError(fmt.Errorf("%w in block %d", ErrChecksum, i), (e.offset+e.length)*8, start+e.size)
+	}
+
+	z.mu.Lock()
+	z.cached, z.cache = i, data
+	z.mu.Unlock()
+	return data, nil
+}
+
+// ReadAt reads len(p) bytes of original data starting at offset off. It is safe for concurrent use.
+func (z *SeekableReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("arithmetic: negative offset")
+	}
+	if off >= z.size {
+		return 0, io.EOF
+	}
+
+	// The last block starting at or before off
+	i := sort.Search(len(z.start), func(i int) bool { return z.start[i] > off }) - 1
+	for n < len(p) && i < len(z.index) {
+		data, err := z.block(i)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[off+int64(n)-z.start[i]:])
+		i++
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read reads original data starting at position set by Seek.
+func (z *SeekableReader) Read(p []byte) (n int, err error) {
+	if z.pos >= z.size {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > z.size-z.pos {
+		p = p[:z.size-z.pos]
+	}
+	n, err = z.ReadAt(p, z.pos)
+	z.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets position of the next Read, interpreted according to whence.
+func (z *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += z.pos
+	case io.SeekEnd:
+		offset += z.size
+	default:
+		return 0, errors.New("arithmetic: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("arithmetic: negative position")
+	}
+	z.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,136 @@
+package arithmetic
+
+import (
+	"time"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/model"
+	"github.com/cravtos/arithmetic/internal/pkg/timing"
+)
+
+// sampleRate is number of symbols, which one of them is timed.
+// Reading clock takes about as long as coding symbol, so time of every symbol isn't measured.
+const sampleRate = 64
+
+// timedCoder measures time spent on buffers and blocks of symbols, started by measure.
+// It is split between Modeling and Coding in proportion measured on every sampleRate-th symbol.
+type timedCoder struct {
+	m       model.Coder
+	t       *timing.Timings
+	symbols int
+	total   time.Duration // time spent on sampled symbols
+	coding  time.Duration // time spent in coder on sampled symbols
+	enc     timedEncoder
+	dec     timedDecoder
+}
+
+// timed returns m measuring its time, if config.Options.Timings is set
+func timed(m model.Coder, opts config.Options) model.Coder {
+	if opts.Timings == nil {
+		return m
+	}
+	return &timedCoder{m: m, t: opts.Timings}
+}
+
+// measure starts measuring time spent on symbols coded by m, if it is timed. Returned function stops it.
+func measure(m model.Coder) func() {
+	c, ok := m.(*timedCoder)
+	if !ok {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		c.add(time.Since(start))
+	}
+}
+
+// add splits d between Modeling and Coding
+func (c *timedCoder) add(d time.Duration) {
+	if c.total == 0 {
+		c.t.AddModeling(d)
+		return
+	}
+	coding := time.Duration(float64(d) * float64(c.coding) / float64(c.total))
+	c.t.AddCoding(coding)
+	c.t.AddModeling(d - coding)
+}
+
+// sample reports if symbol being coded is timed. The first one is, so short streams are timed too.
+func (c *timedCoder) sample() bool {
+	timed := c.symbols == 0
+	if c.symbols++; c.symbols == sampleRate {
+		c.symbols = 0
+	}
+	return timed
+}
+
+func (c *timedCoder) EncodeSymbol(e model.Encoder, symbol int) error {
+	if !c.sample() {
+		return c.m.EncodeSymbol(e, symbol)
+	}
+	c.enc.e = e
+	start, coding := time.Now(), c.enc.coding
+	err := c.m.EncodeSymbol(&c.enc, symbol)
+	c.total += time.Since(start)
+	c.coding += c.enc.coding - coding
+	return err
+}
+
+func (c *timedCoder) DecodeSymbol(d model.Decoder) (int, error) {
+	if !c.sample() {
+		return c.m.DecodeSymbol(d)
+	}
+	c.dec.d = d
+	start, coding := time.Now(), c.dec.coding
+	symbol, err := c.m.DecodeSymbol(&c.dec)
+	c.total += time.Since(start)
+	c.coding += c.dec.coding - coding
+	return symbol, err
+}
+
+// timedEncoder measures time spent in encoder
+type timedEncoder struct {
+	e      model.Encoder
+	coding time.Duration
+}
+
+func (e *timedEncoder) Encode(low, high, total uint64) error {
+	start := time.Now()
+	err := e.e.Encode(low, high, total)
+	e.coding += time.Since(start)
+	return err
+}
+
+func (e *timedEncoder) EncodeBit(p *model.Prob, bit int) error {
+	start := time.Now()
+	err := e.e.EncodeBit(p, bit)
+	e.coding += time.Since(start)
+	return err
+}
+
+// timedDecoder measures time spent in decoder
+type timedDecoder struct {
+	d      model.Decoder
+	coding time.Duration
+}
+
+func (d *timedDecoder) Target(total uint64) (uint64, error) {
+	start := time.Now()
+	freq, err := d.d.Target(total)
+	d.coding += time.Since(start)
+	return freq, err
+}
+
+func (d *timedDecoder) Decode(low, high, total uint64) error {
+	start := time.Now()
+	err := d.d.Decode(low, high, total)
+	d.coding += time.Since(start)
+	return err
+}
+
+func (d *timedDecoder) DecodeBit(p *model.Prob) (int, error) {
+	start := time.Now()
+	bit, err := d.d.DecodeBit(p)
+	d.coding += time.Since(start)
+	return bit, err
+}
@@ -0,0 +1,319 @@
+package arithmetic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/table"
+	"github.com/cravtos/arithmetic/internal/pkg/timing"
+	"github.com/icza/bitio"
+)
+
+// ErrWriterClosed is returned when Writer is used after Close
+var ErrWriterClosed = errors.New("arithmetic: write to closed writer")
+
+// Writer compresses data written to it.
+type Writer struct {
+	w *bitio.Writer
+	h header
+
+	opts config.Options
+
+	// eof is set when size is unknown
+	eof  bool
+	size uint64 // number of bytes declared in header
+	n    uint64 // number of bytes written
+	crc  uint32 // checksum of bytes written
+
+	// static is set when stream is coded with static model, which needs all data counted before coding.
+	// Until then data is kept in pending, unless it is counted by prescan.
+	static  *table.Static
+	pending *bytes.Buffer
+
+	// chunks is set when data is coded in chunks with one model.
+	// Data of the current chunk is kept in chunk until it is full.
+	chunks *chunkWriter
+	chunk  []byte
+
+	// blocks is set when data is split into independently coded blocks.
+	// Data of the current block is kept in block until it is full.
+	blocks *blockWriter
+	block  []byte
+
+	wroteHeader bool
+	closed      bool
+	err         error
+}
+
+// NewWriter returns Writer compressing to w with coder parameters opts.
+// If size is negative, it is unknown, and the end of stream is marked in it.
+// Otherwise exactly size bytes have to be written.
+// Invalid opts are reported by the first call to Write or Close.
+func NewWriter(w io.Writer, size int64, opts config.Options) *Writer {
+	z := &Writer{}
+	z.Reset(w, size, opts)
+	return z
+}
+
+// Reset discards Writer state and makes it equivalent to NewWriter(w, size, opts).
+func (z *Writer) Reset(w io.Writer, size int64, opts config.Options) {
+	if opts.Timings != nil {
+		w = timing.Writer(w, opts.Timings)
+	}
+	*z = Writer{w: bitio.NewWriter(w), opts: opts}
+	if err := opts.Validate(); err != nil {
+		z.err = fmt.Errorf("%w: %v", ErrParameters, err)
+		return
+	}
+	z.h = newHeader(opts)
+	z.h.flags |= flagChecksum
+	z.eof = size < 0
+	if !z.eof {
+		z.size = uint64(size)
+		z.h.size = z.size
+	}
+	if opts.BlockSize > 0 {
+		z.h.flags |= flagBlocks
+		if opts.Seekable {
+			z.h.flags |= flagIndex
+		}
+		z.blocks = newBlockWriter(z.w, z.h, opts)
+		return
+	}
+
+	z.h.flags |= flagChunks
+	if z.eof {
+		z.h.flags |= flagEOF
+	}
+	if z.chunks, z.err = newChunkWriter(z.w, z.h, opts); z.err != nil {
+		return
+	}
+	if z.static = z.chunks.static; z.static != nil {
+		z.pending = &bytes.Buffer{}
+	}
+	capacity := uint64(chunkSize)
+	if !z.eof && z.size < capacity {
+		capacity = z.size
+	}
+	z.chunk = make([]byte, 0, capacity)
+}
+
+// SetMeta records information about original file in header. It has to be called before the first Write.
+func (z *Writer) SetMeta(m Meta) {
+	if z.wroteHeader {
+		if z.err == nil {
+			z.err = errors.New("arithmetic: meta set after header is written")
+		}
+		return
+	}
+	z.h.setMeta(m)
+}
+
+// prescan counts frequencies of data left in r for static model, and seeks r back,
+// so the data needn't be kept in memory. It does nothing if r can't seek.
+func (z *Writer) prescan(r io.ReadSeeker) error {
+	if z.pending == nil || z.pending.Len() > 0 {
+		return nil
+	}
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(buf)
+		z.static.Count(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	z.pending = nil
+	_, err = r.Seek(start, io.SeekStart)
+	return err
+}
+
+func (z *Writer) writeHeader() error {
+	z.wroteHeader = true
+	n, err := z.h.write(z.w)
+	if z.blocks != nil {
+		z.blocks.offset = uint64(n)
+	}
+	return err
+}
+
+// Write compresses p.
+func (z *Writer) Write(p []byte) (n int, err error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, ErrWriterClosed
+	}
+	if z.pending != nil {
+		z.static.Count(p)
+		return z.pending.Write(p)
+	}
+	if z.blocks != nil {
+		return z.writeBlocks(p)
+	}
+	return z.writeChunks(p)
+}
+
+// writeChunks appends p to the current chunk, and codes chunks which are full
+func (z *Writer) writeChunks(p []byte) (n int, err error) {
+	if !z.wroteHeader {
+		if z.err = z.writeHeader(); z.err != nil {
+			return 0, z.err
+		}
+	}
+	if !z.eof && z.n+uint64(len(p)) > z.size {
+		z.err = errors.New("arithmetic: wrote more bytes than declared size")
+		return 0, z.err
+	}
+
+	for n < len(p) {
+		m := copy(z.chunk[len(z.chunk):cap(z.chunk)], p[n:])
+		z.chunk = z.chunk[:len(z.chunk)+m]
+		n += m
+
+		if len(z.chunk) == cap(z.chunk) {
+			if z.err = z.chunks.write(z.chunk); z.err != nil {
+				return n, z.err
+			}
+			z.chunk = z.chunk[:0]
+		}
+	}
+	z.n += uint64(n)
+	z.crc = crc32.Update(z.crc, crcTable, p)
+	return n, nil
+}
+
+// closeChunks codes the last chunk, and terminates chunks
+func (z *Writer) closeChunks() error {
+	if !z.wroteHeader {
+		if err := z.writeHeader(); err != nil {
+			return err
+		}
+	}
+	if !z.eof && z.n != z.size {
+		return errors.New("arithmetic: wrote less bytes than declared size")
+	}
+	if len(z.chunk) > 0 {
+		if err := z.chunks.write(z.chunk); err != nil {
+			return err
+		}
+		z.chunk = z.chunk[:0]
+	}
+	return z.chunks.close()
+}
+
+// writeBlocks appends p to the current block, and starts encoding of blocks which are full
+func (z *Writer) writeBlocks(p []byte) (n int, err error) {
+	if !z.wroteHeader {
+		if z.err = z.writeHeader(); z.err != nil {
+			return 0, z.err
+		}
+	}
+	if !z.eof && z.n+uint64(len(p)) > z.size {
+		z.err = errors.New("arithmetic: wrote more bytes than declared size")
+		return 0, z.err
+	}
+
+	for n < len(p) {
+		if z.block == nil {
+			z.block = make([]byte, 0, z.h.blockSize)
+		}
+		m := copy(z.block[len(z.block):cap(z.block)], p[n:])
+		z.block = z.block[:len(z.block)+m]
+		n += m
+
+		if len(z.block) == cap(z.block) {
+			block := z.block
+			z.block = nil
+			if z.err = z.blocks.add(block); z.err != nil {
+				z.blocks.wait()
+				return n, z.err
+			}
+		}
+	}
+	z.n += uint64(n)
+	z.crc = crc32.Update(z.crc, crcTable, p)
+	return n, nil
+}
+
+// closeBlocks encodes the last block, and writes out all blocks left
+func (z *Writer) closeBlocks() error {
+	if !z.wroteHeader {
+		if err := z.writeHeader(); err != nil {
+			return err
+		}
+	}
+	if !z.eof && z.n != z.size {
+		z.blocks.wait()
+		return errors.New("arithmetic: wrote less bytes than declared size")
+	}
+	if len(z.block) > 0 {
+		if err := z.blocks.add(z.block); err != nil {
+			z.blocks.wait()
+			return err
+		}
+		z.block = nil
+	}
+	return z.blocks.close()
+}
+
+// Close finishes compressed stream. It does not close the underlying writer.
+func (z *Writer) Close() error {
+	if z.closed {
+		return z.err
+	}
+	z.closed = true
+	if z.err != nil {
+		return z.err
+	}
+
+	if z.pending != nil {
+		// All data is counted now
+		pending := z.pending
+		z.pending = nil
+		if _, z.err = z.writeChunks(pending.Bytes()); z.err != nil {
+			return z.err
+		}
+	}
+
+	if z.blocks != nil {
+		z.err = z.closeBlocks()
+	} else {
+		z.err = z.closeChunks()
+	}
+	if z.err != nil {
+		return z.err
+	}
+	return z.writeTrailer()
+}
+
+// writeTrailer writes checksum, and flushes everything to underlying writer
+func (z *Writer) writeTrailer() error {
+	if _, z.err = z.w.Align(); z.err != nil {
+		return z.err
+	}
+	trailer := make([]byte, 4)
+	binary.BigEndian.PutUint32(trailer, z.crc)
+	if _, z.err = z.w.Write(trailer); z.err != nil {
+		return z.err
+	}
+
+	// Flush everything to underlying writer
+	z.err = z.w.Close()
+	return z.err
+}
@@ -1,16 +1,187 @@
 package config
 
-// IntervalBitsUsed determines how many bits is used by interval
-// Should be greater than CountBitsUsed, less than 64
-// Also CountBitsUsed + IntervalBitsUsed should be < 64
-// Otherwise there will be overflows
-const IntervalBitsUsed = 32
+import (
+	"fmt"
 
-// CountDenominator is number on which count will be divided for normalization
-const CountDenominator = 2
+	"github.com/cravtos/arithmetic/internal/pkg/model"
+	"github.com/cravtos/arithmetic/internal/pkg/timing"
+)
 
-// CountBitsUsed determines bits for maximal sum of all symbol counts
-const CountBitsUsed = 16
+// ModelKind selects built-in model
+// Values are recorded in stream header, so they must not be changed
+type ModelKind uint8
 
-// UpdateRangesRate determines how often ranges are recalculated
-const UpdateRangesRate = 1000
+const (
+	// ModelAdaptive is adaptive order-0 table.Table, which ranges are recalculated every UpdateRangesRate symbols
+	ModelAdaptive ModelKind = 0
+	// ModelFenwick is adaptive order-0 table.Fenwick, which ranges are always valid
+	ModelFenwick ModelKind = 1
+	// ModelOrder1 is adaptive order-1 table.Context, which uses previous byte as context
+	ModelOrder1 ModelKind = 2
+	// ModelOrder2 is adaptive order-2 table.Context, which uses hash of two previous bytes as context
+	ModelOrder2 ModelKind = 3
+	// ModelPPM is ppm.Model, which blends contexts of orders up to PPMOrder
+	ModelPPM ModelKind = 4
+	// ModelBinary is model.Binary, which codes bytes bit by bit with adaptive probabilities
+	ModelBinary ModelKind = 5
+	// ModelStatic is table.Static, which frequencies are counted before coding and stored in stream
+	ModelStatic ModelKind = 6
+
+	lastModelKind = ModelStatic
+)
+
+// MaxPPMOrder is the maximal order of PPM model
+const MaxPPMOrder = 16
+
+// MaxBlockSize is the maximal number of bytes in a block
+const MaxBlockSize = 1 << 30
+
+// String returns name of the model
+func (k ModelKind) String() string {
+	switch k {
+	case ModelAdaptive:
+		return "adaptive"
+	case ModelFenwick:
+		return "fenwick"
+	case ModelOrder1:
+		return "order1"
+	case ModelOrder2:
+		return "order2"
+	case ModelPPM:
+		return "ppm"
+	case ModelBinary:
+		return "binary"
+	case ModelStatic:
+		return "static"
+	}
+	return fmt.Sprintf("ModelKind(%d)", uint8(k))
+}
+
+// Known reports whether k is a built-in model
+func (k ModelKind) Known() bool {
+	return k <= lastModelKind
+}
+
+// ParseModelKind returns model with given name
+func ParseModelKind(name string) (ModelKind, error) {
+	for k := ModelAdaptive; k.Known(); k++ {
+		if k.String() == name {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown model %q", name)
+}
+
+// Options holds parameters of the coder
+type Options struct {
+	// IntervalBitsUsed determines how many bits is used by interval
+	// Should be greater than CountBitsUsed by at least 2, less than 64
+	// Also CountBitsUsed + IntervalBitsUsed should be < 64
+	// Otherwise there will be overflows
+	IntervalBitsUsed uint8
+
+	// CountDenominator is number on which count will be divided for normalization
+	CountDenominator uint8
+
+	// CountBitsUsed determines bits for maximal sum of all symbol counts
+	CountBitsUsed uint8
+
+	// UpdateRangesRate determines how often ranges are recalculated
+	UpdateRangesRate uint64
+
+	// ModelKind selects built-in model, if Model is nil
+	ModelKind ModelKind
+
+	// PPMOrder is the maximal order of contexts used by PPM model
+	PPMOrder uint8
+
+	// PPMMemory is memory limit of PPM model in MiB. Model is reset when it is reached
+	PPMMemory uint64
+
+	// BlockSize is number of bytes in independently coded blocks. If 0, data is coded with one model in chunks,
+	// which are written out as they are full, and any of them is stored as is if coding expands it
+	BlockSize uint64
+
+	// Seekable adds index of blocks to the end of stream, so data can be read at any position
+	// It needs BlockSize to be set
+	Seekable bool
+
+	// Workers is number of blocks coded in parallel. If 0, number of CPUs is used
+	// It isn't recorded in stream
+	Workers int
+
+	// MaxOutput is the maximal number of bytes decoder produces. If 0, output isn't limited
+	// It isn't recorded in stream
+	MaxOutput uint64
+
+	// MaxRatio is the maximal ratio of decoded bytes to bytes of stream read. If 0, ratio isn't limited
+	// The first MiB of output isn't limited by it, so short streams of redundant data aren't rejected
+	// It isn't recorded in stream
+	MaxRatio uint64
+
+	// Timings accumulates time spent in phases of coding, if it isn't nil. Its split between modeling and coding is estimated on sampled symbols
+	// It isn't recorded in stream
+	Timings *timing.Timings
+
+	// Model constructs custom model. If nil, model selected by ModelKind is used
+	// Custom model isn't recorded in stream, so decoder has to be given the same one
+	Model model.Factory
+
+	// Coder constructs custom model, which codes symbols by itself. It takes precedence over Model
+	Coder model.CoderFactory
+}
+
+// Custom reports whether custom model is given
+func (o Options) Custom() bool {
+	return o.Model != nil || o.Coder != nil
+}
+
+// minCountBitsUsed leaves room for counts of all symbols to grow before normalization
+const minCountBitsUsed = 10
+
+// Default returns options used when nothing else is specified
+func Default() Options {
+	return Options{
+		IntervalBitsUsed: 32,
+		CountDenominator: 2,
+		CountBitsUsed:    16,
+		UpdateRangesRate: 1000,
+		PPMOrder:         4,
+		PPMMemory:        64,
+	}
+}
+
+// Validate reports whether coder can work with given options
+func (o Options) Validate() error {
+	switch {
+	case o.CountBitsUsed < minCountBitsUsed:
+		return fmt.Errorf("CountBitsUsed (%d) should be at least %d", o.CountBitsUsed, minCountBitsUsed)
+	case o.IntervalBitsUsed < o.CountBitsUsed+2:
+		return fmt.Errorf("IntervalBitsUsed (%d) should be greater than CountBitsUsed (%d) by at least 2",
+			o.IntervalBitsUsed, o.CountBitsUsed)
+	case int(o.IntervalBitsUsed)+int(o.CountBitsUsed) >= 64:
+		return fmt.Errorf("IntervalBitsUsed (%d) + CountBitsUsed (%d) should be less than 64",
+			o.IntervalBitsUsed, o.CountBitsUsed)
+	case o.CountDenominator < 2:
+		return fmt.Errorf("CountDenominator (%d) should be at least 2", o.CountDenominator)
+	case o.UpdateRangesRate < 1:
+		return fmt.Errorf("UpdateRangesRate (%d) should be at least 1", o.UpdateRangesRate)
+	case o.BlockSize > MaxBlockSize:
+		return fmt.Errorf("BlockSize (%d) should be at most %d", o.BlockSize, MaxBlockSize)
+	case o.Seekable && o.BlockSize == 0:
+		return fmt.Errorf("Seekable stream needs BlockSize")
+	case o.Workers < 0:
+		return fmt.Errorf("Workers (%d) should not be negative", o.Workers)
+	case !o.Custom() && !o.ModelKind.Known():
+		return fmt.Errorf("unknown %v", o.ModelKind)
+	case !o.Custom() && o.ModelKind == ModelPPM && o.PPMOrder > MaxPPMOrder:
+		return fmt.Errorf("PPMOrder (%d) should be at most %d", o.PPMOrder, MaxPPMOrder)
+	case !o.Custom() && o.ModelKind == ModelPPM && o.PPMMemory < 1:
+		return fmt.Errorf("PPMMemory (%d) should be at least 1", o.PPMMemory)
+	case !o.Custom() && (o.ModelKind == ModelBinary || o.ModelKind == ModelStatic) && o.IntervalBitsUsed < model.ProbBits+2:
+		return fmt.Errorf("IntervalBitsUsed (%d) should be at least %d for %v model", o.IntervalBitsUsed, model.ProbBits+2, o.ModelKind)
+	case !o.Custom() && (o.ModelKind == ModelBinary || o.ModelKind == ModelStatic) && int(o.IntervalBitsUsed)+model.ProbBits >= 64:
+		return fmt.Errorf("IntervalBitsUsed (%d) + ProbBits (%d) should be less than 64 for %v model", o.IntervalBitsUsed, model.ProbBits, o.ModelKind)
+	}
+	return nil
+}
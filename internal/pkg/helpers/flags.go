@@ -0,0 +1,180 @@
+package helpers
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/timing"
+	"github.com/pkg/profile"
+)
+
+// DefaultMaxRatio rejects decompression bombs, while leaving room for highly redundant data.
+const DefaultMaxRatio = 100000
+
+// EncodeFlags defines flags of coder parameters in fs.
+// Returned function gives options set by them, after fs is parsed.
+func EncodeFlags(fs *flag.FlagSet) func() (config.Options, error) {
+	defaults := config.Default()
+	intervalBits := fs.Uint("interval-bits", uint(defaults.IntervalBitsUsed), "Bits used by coder interval.")
+	countBits := fs.Uint("count-bits", uint(defaults.CountBitsUsed), "Bits used by sum of symbol counts.")
+	countDenominator := fs.Uint("count-denominator", uint(defaults.CountDenominator), "Divisor of symbol counts on normalization.")
+	updateRate := fs.Uint64("update-rate", defaults.UpdateRangesRate, "Number of symbols between recalculations of ranges.")
+	modelName := fs.String("model", defaults.ModelKind.String(), "Model: adaptive, fenwick, order1, order2, ppm, binary or static.")
+	ppmOrder := fs.Uint("ppm-order", uint(defaults.PPMOrder), "Maximal context order of ppm model.")
+	ppmMemory := fs.Uint64("ppm-memory", defaults.PPMMemory, "Memory limit of ppm model in MiB, model is reset when it is reached.")
+	blockSize := fs.Uint64("block-size", defaults.BlockSize, "Size of independently coded blocks in bytes, 0 codes input as a single block.")
+	seekable := fs.Bool("seekable", false, "Add index of blocks, so output can be read at any position. Needs -block-size.")
+	workers := fs.Int("workers", defaults.Workers, "Number of blocks encoded in parallel, 0 uses all CPUs.")
+
+	return func() (config.Options, error) {
+		if *intervalBits > math.MaxUint8 || *countBits > math.MaxUint8 || *countDenominator > math.MaxUint8 || *ppmOrder > math.MaxUint8 {
+			return config.Options{}, errors.New("coder parameters are out of range")
+		}
+		modelKind, err := config.ParseModelKind(*modelName)
+		if err != nil {
+			return config.Options{}, err
+		}
+		opts := config.Options{
+			IntervalBitsUsed: uint8(*intervalBits),
+			CountDenominator: uint8(*countDenominator),
+			CountBitsUsed:    uint8(*countBits),
+			UpdateRangesRate: *updateRate,
+			ModelKind:        modelKind,
+			PPMOrder:         uint8(*ppmOrder),
+			PPMMemory:        *ppmMemory,
+			BlockSize:        *blockSize,
+			Seekable:         *seekable,
+			Workers:          *workers,
+		}
+		if err := opts.Validate(); err != nil {
+			return config.Options{}, fmt.Errorf("invalid coder parameters: %v", err)
+		}
+		return opts, nil
+	}
+}
+
+// DecodeFlags defines flags of decoder parallelism and output limits in fs.
+// Returned function gives options set by them, after fs is parsed.
+func DecodeFlags(fs *flag.FlagSet) func() (config.Options, error) {
+	workers := fs.Int("workers", 0, "Number of blocks decoded in parallel, 0 uses all CPUs.")
+	maxOutput := fs.Uint64("max-output", 0, "Fail if decoded data is larger than this number of bytes, 0 means no limit.")
+	maxRatio := fs.Uint64("max-ratio", DefaultMaxRatio,
+		"Fail if decoded data grows more than this times larger than input, 0 means no limit.")
+
+	return func() (config.Options, error) {
+		opts := config.Default()
+		opts.Workers = *workers
+		opts.MaxOutput = *maxOutput
+		opts.MaxRatio = *maxRatio
+		if err := opts.Validate(); err != nil {
+			return config.Options{}, fmt.Errorf("invalid coder parameters: %v", err)
+		}
+		return opts, nil
+	}
+}
+
+// ProfileFlags defines flags of profiling in fs. They take path of file, where profile is written.
+// Profiling is done by github.com/pkg/profile, which runs a single profile at a time, so only one of them may be given.
+// Returned function starts profiling selected by them, after fs is parsed.
+// Stop of its result has to be called before exit, so profile is written out.
+func ProfileFlags(fs *flag.FlagSet) func() (*Profiles, error) {
+	cpu := fs.String("cpuprofile", "", "Write CPU profile to file.")
+	mem := fs.String("memprofile", "", "Write memory profile to file.")
+	trace := fs.String("trace", "", "Write execution trace to file.")
+	block := fs.String("blockprofile", "", "Write goroutine blocking profile to file.")
+
+	return func() (*Profiles, error) {
+		// Profile is written by pkg/profile under its own name, in directory next to path
+		var modes []profileMode
+		for _, m := range []profileMode{
+			{*cpu, "cpu.pprof", profile.CPUProfile},
+			{*mem, "mem.pprof", profile.MemProfile},
+			{*trace, "trace.out", profile.TraceProfile},
+			{*block, "block.pprof", profile.BlockProfile},
+		} {
+			if m.path != "" {
+				modes = append(modes, m)
+			}
+		}
+		switch len(modes) {
+		case 0:
+			return &Profiles{}, nil
+		case 1:
+		default:
+			return nil, errors.New("only one of -cpuprofile, -memprofile, -trace and -blockprofile may be given")
+		}
+
+		m := modes[0]
+		dir, err := ioutil.TempDir(filepath.Dir(m.path), ".profile")
+		if err != nil {
+			return nil, fmt.Errorf("can't create profile: %v", err)
+		}
+		p := &Profiles{path: m.path, dir: dir, name: m.name}
+		p.profile = profile.Start(m.mode, profile.ProfilePath(dir), profile.Quiet, profile.NoShutdownHook)
+		return p, nil
+	}
+}
+
+// profileMode is a profile, which may be selected by ProfileFlags
+type profileMode struct {
+	path string // path of file, where profile is written, empty if it isn't selected
+	name string // name of file, which profile is written to by pkg/profile
+	mode func(*profile.Profile)
+}
+
+// Profiles writes profile selected by ProfileFlags
+type Profiles struct {
+	profile interface{ Stop() }
+	path    string
+	dir     string // directory, where profile is written by pkg/profile before it is moved to path
+	name    string
+}
+
+// Stop stops profiling, and writes out profile. It may be called more than once.
+func (p *Profiles) Stop() error {
+	if p.profile == nil {
+		return nil
+	}
+	p.profile.Stop()
+	p.profile = nil
+
+	err := os.Rename(filepath.Join(p.dir, p.name), p.path)
+	os.RemoveAll(p.dir)
+	if err != nil {
+		return fmt.Errorf("got error while writing profile: %v", err)
+	}
+	return nil
+}
+
+// Exit stops profiling, and exits with code. Unlike os.Exit, it doesn't lose profile, which deferred Stop would write.
+func (p *Profiles) Exit(code int) {
+	if err := p.Stop(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// PrintTimings prints time spent in phases of coding, out of total time.
+func PrintTimings(w io.Writer, t *timing.Timings, total time.Duration) {
+	other := total - t.IO() - t.Modeling() - t.Coding()
+	if other < 0 {
+		// Blocks coded in parallel take more time, than passes
+		other = 0
+	}
+	fmt.Fprintf(w, "io:       %v\n", t.IO())
+	fmt.Fprintf(w, "modeling: %v\n", t.Modeling())
+	fmt.Fprintf(w, "coding:   %v\n", t.Coding())
+	fmt.Fprintf(w, "other:    %v\n", other)
+	fmt.Fprintf(w, "total:    %v\n", total)
+}
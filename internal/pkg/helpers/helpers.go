@@ -2,9 +2,14 @@ package helpers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
 )
 
 // PrintRatio prints compression ratio for two files.
@@ -54,4 +59,89 @@ func CompareFiles(f *os.File, s *os.File) (bool, error) {
 			return false, nil
 		}
 	}
-}
\ No newline at end of file
+}
+
+// IsStdio reports whether path means standard input or output, which is empty path or "-".
+func IsStdio(path string) bool {
+	return path == "" || path == "-"
+}
+
+// OpenInput opens file at path for reading, or returns standard input if IsStdio(path).
+func OpenInput(path string) (*os.File, error) {
+	if IsStdio(path) {
+		return os.Stdin, nil
+	}
+	return os.Open(path)
+}
+
+// CreateOutput creates file at path for writing, or returns standard output if IsStdio(path).
+func CreateOutput(path string) (*os.File, error) {
+	if IsStdio(path) {
+		return os.Stdout, nil
+	}
+	return os.Create(path)
+}
+
+// CreateFile creates file at path with permissions perm. Existing file is overwritten only if force is set.
+func CreateFile(path string, perm os.FileMode, force bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	out, err := os.OpenFile(path, flags, perm)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%s already exists, use -f to overwrite", path)
+	}
+	return out, err
+}
+
+// CreateDecoded creates file at outPath for data decoded from compressed file at inPath.
+// Compressed file itself is never overwritten, and other existing file is overwritten only if force is set.
+func CreateDecoded(inPath string, outPath string, force bool) (*os.File, error) {
+	if !IsStdio(inPath) {
+		inStat, err := os.Stat(inPath)
+		if err != nil {
+			return nil, err
+		}
+		outStat, err := os.Stat(outPath)
+		if filepath.Clean(outPath) == filepath.Clean(inPath) || err == nil && os.SameFile(inStat, outStat) {
+			return nil, fmt.Errorf("%s is the compressed file itself, refusing to overwrite it", outPath)
+		}
+	}
+	return CreateFile(outPath, 0666, force)
+}
+
+// IsTerminal reports whether f is a terminal.
+func IsTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// StoredPath returns path of file named by original name stored in compressed file at inPath.
+// The file is placed next to compressed one, or in current directory if it is read from standard input.
+func StoredPath(inPath string, name string) (string, error) {
+	dir := filepath.Dir(inPath)
+	if IsStdio(inPath) {
+		inPath, dir = "standard input", "."
+	}
+	if name == "" {
+		return "", fmt.Errorf("%s has no original name stored", inPath)
+	}
+	if name != filepath.Base(name) || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("%s has invalid original name %q", inPath, name)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// RestoreMeta restores modification time and permissions of decompressed file f, which are stored in meta.
+func RestoreMeta(f *os.File, meta arithmetic.Meta) error {
+	if meta.Mode != 0 {
+		if err := f.Chmod(meta.Mode); err != nil {
+			return err
+		}
+	}
+	if !meta.ModTime.IsZero() {
+		return os.Chtimes(f.Name(), meta.ModTime, meta.ModTime)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package model
+
+// byteTreeSize is number of probabilities in binary tree coding a byte, bit by bit from the highest one
+const byteTreeSize = 256
+
+// Binary codes every byte as 8 bits with adaptive probabilities, which depend on the preceding byte
+// and on higher bits of the byte already coded. If EOF symbol is in alphabet, every symbol is preceded by EOF flag.
+type Binary struct {
+	eof   bool
+	isEOF Prob
+	// probs[prev][node] is probability of bit at node of binary tree, when prev is the preceding byte
+	probs [][]Prob
+	prev  int
+}
+
+// NewBinary constructs binary model for alphabet of given size
+func NewBinary(symbols int) *Binary {
+	b := &Binary{
+		eof:   symbols > byteTreeSize,
+		isEOF: ProbInit,
+		probs: make([][]Prob, byteTreeSize),
+	}
+	for i := range b.probs {
+		b.probs[i] = NewProbs(byteTreeSize)
+	}
+	return b
+}
+
+// EncodeSymbol codes EOF flag, if needed, and bits of symbol
+func (b *Binary) EncodeSymbol(e Encoder, symbol int) error {
+	if b.eof {
+		flag := 0
+		if symbol == byteTreeSize {
+			flag = 1
+		}
+		if err := e.EncodeBit(&b.isEOF, flag); err != nil || flag == 1 {
+			return err
+		}
+	}
+
+	probs := b.probs[b.prev]
+	node := 1
+	for i := 7; i >= 0; i-- {
+		bit := (symbol >> i) & 1
+		if err := e.EncodeBit(&probs[node], bit); err != nil {
+			return err
+		}
+		node = node<<1 | bit
+	}
+
+	b.prev = symbol
+	return nil
+}
+
+// DecodeSymbol decodes EOF flag, if needed, and bits of symbol
+func (b *Binary) DecodeSymbol(d Decoder) (int, error) {
+	if b.eof {
+		flag, err := d.DecodeBit(&b.isEOF)
+		if err != nil {
+			return 0, err
+		}
+		if flag == 1 {
+			return byteTreeSize, nil
+		}
+	}
+
+	probs := b.probs[b.prev]
+	node := 1
+	for node < byteTreeSize {
+		bit, err := d.DecodeBit(&probs[node])
+		if err != nil {
+			return 0, err
+		}
+		node = node<<1 | bit
+	}
+
+	b.prev = node - byteTreeSize
+	return b.prev, nil
+}
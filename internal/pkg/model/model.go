@@ -0,0 +1,92 @@
+package model
+
+import "errors"
+
+// ErrCorrupt is returned by Coder, when data it decodes can't be produced by encoder
+var ErrCorrupt = errors.New("arithmetic: corrupted data")
+
+// Model gives cumulative frequencies of symbols to the coder, and learns from coded symbols.
+// Symbols are numbered from 0, alphabet size is given to Factory.
+// Encoder and decoder have to see models in the same state, so the model may depend only on symbols coded before.
+type Model interface {
+	// Interval returns frequency range [low, high) of symbol out of total.
+	// Range shouldn't be empty, and total should be less than 2^CountBitsUsed.
+	Interval(symbol int) (low, high, total uint64)
+
+	// Total returns sum of frequencies of all symbols
+	Total() uint64
+
+	// Symbol returns symbol which frequency range contains freq, 0 <= freq < Total()
+	Symbol(freq uint64) int
+
+	// Update is called after symbol is coded
+	Update(symbol int)
+}
+
+// Factory constructs new model for alphabet of given size.
+// Alphabet is 256 bytes, possibly followed by EOF symbol.
+type Factory func(symbols int) Model
+
+// Encoder narrows coder interval to [low, high) out of total
+type Encoder interface {
+	Encode(low, high, total uint64) error
+
+	// EncodeBit narrows interval according to probability of bit, and updates the probability
+	EncodeBit(p *Prob, bit int) error
+}
+
+// Decoder follows intervals narrowed by Encoder
+type Decoder interface {
+	// Target returns frequency out of total, which lies in the interval encoded next
+	Target(total uint64) (uint64, error)
+
+	// Decode narrows interval the same way Encoder did. It should contain frequency returned by Target.
+	Decode(low, high, total uint64) error
+
+	// DecodeBit returns bit encoded by Encoder.EncodeBit, and updates its probability the same way
+	DecodeBit(p *Prob) (int, error)
+}
+
+// Coder codes every symbol as a sequence of one or more intervals, e.g. escapes followed by symbol
+type Coder interface {
+	EncodeSymbol(e Encoder, symbol int) error
+	DecodeSymbol(d Decoder) (int, error)
+}
+
+// CoderFactory constructs new Coder for alphabet of given size.
+type CoderFactory func(symbols int) Coder
+
+// NewCoder returns Coder which codes every symbol with single interval given by m
+func NewCoder(m Model) Coder {
+	return modelCoder{m: m}
+}
+
+type modelCoder struct {
+	m Model
+}
+
+func (c modelCoder) EncodeSymbol(e Encoder, symbol int) error {
+	low, high, total := c.m.Interval(symbol)
+	if err := e.Encode(low, high, total); err != nil {
+		return err
+	}
+
+	c.m.Update(symbol)
+	return nil
+}
+
+func (c modelCoder) DecodeSymbol(d Decoder) (int, error) {
+	freq, err := d.Target(c.m.Total())
+	if err != nil {
+		return 0, err
+	}
+
+	symbol := c.m.Symbol(freq)
+	low, high, total := c.m.Interval(symbol)
+	if err := d.Decode(low, high, total); err != nil {
+		return 0, err
+	}
+
+	c.m.Update(symbol)
+	return symbol, nil
+}
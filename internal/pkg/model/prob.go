@@ -0,0 +1,50 @@
+package model
+
+// ProbBits is number of bits of probability precision
+const ProbBits = 12
+
+// probTotal is the probability of certain event
+const probTotal = 1 << ProbBits
+
+// probMoveBits determines adaptation speed of Prob
+const probMoveBits = 5
+
+// ProbInit is probability 1/2, which Prob should be initialized with
+const ProbInit Prob = probTotal / 2
+
+// Prob is adaptive probability of bit being 0, scaled to 1<<ProbBits
+type Prob uint16
+
+// Interval returns interval of bit out of total, which is 1<<ProbBits
+func (p Prob) Interval(bit int) (low, high, total uint64) {
+	if bit == 0 {
+		return 0, uint64(p), probTotal
+	}
+	return uint64(p), probTotal, probTotal
+}
+
+// Bit returns bit which interval contains freq
+func (p Prob) Bit(freq uint64) int {
+	if freq < uint64(p) {
+		return 0
+	}
+	return 1
+}
+
+// Update moves probability towards coded bit
+func (p *Prob) Update(bit int) {
+	if bit == 0 {
+		*p += (probTotal - *p) >> probMoveBits
+	} else {
+		*p -= *p >> probMoveBits
+	}
+}
+
+// NewProbs returns n probabilities initialized with ProbInit
+func NewProbs(n int) []Prob {
+	probs := make([]Prob, n)
+	for i := range probs {
+		probs[i] = ProbInit
+	}
+	return probs
+}
@@ -0,0 +1,283 @@
+package ppm
+
+import (
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/model"
+)
+
+// Approximate memory taken by trie parts, used to check memory limit
+const (
+	nodeSize  = 32
+	entrySize = 16
+)
+
+// entry holds count of symbol seen in context, and node of context extended by the symbol
+type entry struct {
+	child  *node
+	count  uint32
+	symbol uint16
+}
+
+// node holds symbols seen in context
+type node struct {
+	entries []entry
+	total   uint64 // sum of counts of entries
+}
+
+// find returns index of symbol in n.entries, or -1
+func (n *node) find(symbol int) int {
+	for i := range n.entries {
+		if int(n.entries[i].symbol) == symbol {
+			return i
+		}
+	}
+	return -1
+}
+
+// Model is PPM (prediction by partial matching) model, which blends contexts of orders from 0 to maximal one.
+// When symbol wasn't seen in current context, escape is coded and the shorter context is tried,
+// excluding symbols seen in longer ones. Symbols never seen at all are coded with uniform order -1 model.
+// Escape frequency is number of distinct symbols seen in context (PPMC).
+type Model struct {
+	root *node
+	// ctx[k] is node of context made of k preceding symbols, it is nil when context is not seen yet
+	ctx []*node
+	// depth is number of valid contexts in ctx, minus one
+	depth int
+
+	symbols  int
+	maxOrder int
+
+	memory    uint64
+	maxMemory uint64
+
+	maxTotal    uint64
+	denominator uint32
+
+	excluded []bool
+}
+
+// New constructs PPM model for alphabet of given size.
+// opts.PPMOrder is maximal order, and when approximate memory taken by model exceeds opts.PPMMemory MiB, model is reset.
+func New(symbols int, opts config.Options) *Model {
+	m := &Model{
+		symbols:     symbols,
+		maxOrder:    int(opts.PPMOrder),
+		maxMemory:   opts.PPMMemory << 20,
+		maxTotal:    (1 << opts.CountBitsUsed) - 1,
+		denominator: uint32(opts.CountDenominator),
+		ctx:         make([]*node, opts.PPMOrder+1),
+		excluded:    make([]bool, symbols),
+	}
+	m.reset()
+	return m
+}
+
+// reset forgets everything model has learned
+func (m *Model) reset() {
+	m.root = &node{}
+	m.memory = nodeSize
+	m.ctx[0] = m.root
+	m.depth = 0
+}
+
+// clearExcluded marks all symbols as not excluded
+func (m *Model) clearExcluded() {
+	for i := range m.excluded {
+		m.excluded[i] = false
+	}
+}
+
+// totals returns sum of counts of symbols which are not excluded, and escape frequency
+func (m *Model) totals(n *node) (sum, escape uint64) {
+	for _, e := range n.entries {
+		if !m.excluded[e.symbol] {
+			sum += uint64(e.count)
+			escape++
+		}
+	}
+	return sum, escape
+}
+
+// exclude marks all symbols of n as excluded
+func (m *Model) exclude(n *node) {
+	for _, e := range n.entries {
+		m.excluded[e.symbol] = true
+	}
+}
+
+// EncodeSymbol codes escapes from contexts in which symbol wasn't seen, and then symbol itself
+func (m *Model) EncodeSymbol(enc model.Encoder, symbol int) error {
+	m.clearExcluded()
+
+	for k := m.depth; k >= 0; k-- {
+		n := m.ctx[k]
+		sum, escape := m.totals(n)
+		if escape == 0 {
+			// Nothing to code in this context
+			continue
+		}
+
+		low := uint64(0)
+		found := false
+		for _, e := range n.entries {
+			if m.excluded[e.symbol] {
+				continue
+			}
+			if int(e.symbol) == symbol {
+				found = true
+				if err := enc.Encode(low, low+uint64(e.count), sum+escape); err != nil {
+					return err
+				}
+				break
+			}
+			low += uint64(e.count)
+		}
+		if found {
+			m.update(symbol)
+			return nil
+		}
+
+		if err := enc.Encode(sum, sum+escape, sum+escape); err != nil {
+			return err
+		}
+		m.exclude(n)
+	}
+
+	// Order -1: all symbols not excluded are equally probable
+	low, total := uint64(0), uint64(0)
+	for i, excluded := range m.excluded {
+		if !excluded {
+			if i < symbol {
+				low++
+			}
+			total++
+		}
+	}
+	if err := enc.Encode(low, low+1, total); err != nil {
+		return err
+	}
+
+	m.update(symbol)
+	return nil
+}
+
+// DecodeSymbol follows escapes coded by EncodeSymbol, and returns decoded symbol
+func (m *Model) DecodeSymbol(dec model.Decoder) (int, error) {
+	m.clearExcluded()
+
+	for k := m.depth; k >= 0; k-- {
+		n := m.ctx[k]
+		sum, escape := m.totals(n)
+		if escape == 0 {
+			continue
+		}
+
+		freq, err := dec.Target(sum + escape)
+		if err != nil {
+			return 0, err
+		}
+
+		if freq >= sum {
+			if err := dec.Decode(sum, sum+escape, sum+escape); err != nil {
+				return 0, err
+			}
+			m.exclude(n)
+			continue
+		}
+
+		low := uint64(0)
+		for _, e := range n.entries {
+			if m.excluded[e.symbol] {
+				continue
+			}
+			if freq < low+uint64(e.count) {
+				if err := dec.Decode(low, low+uint64(e.count), sum+escape); err != nil {
+					return 0, err
+				}
+				m.update(int(e.symbol))
+				return int(e.symbol), nil
+			}
+			low += uint64(e.count)
+		}
+	}
+
+	// Order -1
+	total := uint64(0)
+	for _, excluded := range m.excluded {
+		if !excluded {
+			total++
+		}
+	}
+	freq, err := dec.Target(total)
+	if err != nil {
+		return 0, err
+	}
+
+	symbol, low := 0, uint64(0)
+	for ; symbol < m.symbols; symbol++ {
+		if m.excluded[symbol] {
+			continue
+		}
+		if low == freq {
+			break
+		}
+		low++
+	}
+	if err := dec.Decode(low, low+1, total); err != nil {
+		return 0, err
+	}
+
+	m.update(symbol)
+	return symbol, nil
+}
+
+// update counts symbol in all current contexts, and moves to contexts extended by it
+func (m *Model) update(symbol int) {
+	for k := m.depth; k >= 0; k-- {
+		n := m.ctx[k]
+		i := n.find(symbol)
+		if i < 0 {
+			n.entries = append(n.entries, entry{symbol: uint16(symbol)})
+			m.memory += entrySize
+			i = len(n.entries) - 1
+		}
+		n.entries[i].count++
+		n.total++
+		if n.total+uint64(len(n.entries)) >= m.maxTotal {
+			m.rescale(n)
+		}
+
+		// Context of order k+1 after symbol is context of order k before it, extended by symbol
+		if k < m.maxOrder {
+			child := n.entries[i].child
+			if child == nil {
+				child = &node{}
+				n.entries[i].child = child
+				m.memory += nodeSize
+			}
+			m.ctx[k+1] = child
+		}
+	}
+
+	if m.depth < m.maxOrder {
+		m.depth++
+	}
+	m.ctx[0] = m.root
+
+	if m.memory > m.maxMemory {
+		m.reset()
+	}
+}
+
+// rescale divides counts of n, so its total fits into coder
+func (m *Model) rescale(n *node) {
+	n.total = 0
+	for i := range n.entries {
+		n.entries[i].count /= m.denominator
+		if n.entries[i].count == 0 {
+			n.entries[i].count = 1
+		}
+		n.total += uint64(n.entries[i].count)
+	}
+}
@@ -0,0 +1,67 @@
+package table
+
+import "github.com/cravtos/arithmetic/internal/pkg/config"
+
+// order2Bits is number of bits of hash of two preceding bytes used as order-2 context
+const order2Bits = 12
+
+// Context holds separate Fenwick table for every context, which is made of preceding bytes.
+// Tables are allocated when context is seen for the first time.
+type Context struct {
+	tables  []*Fenwick
+	order   int
+	history uint32 // preceding bytes, the last one is in the lowest byte
+	size    int
+	opts    config.Options
+}
+
+// NewContext constructs order-1 or order-2 model for alphabet of size symbols
+func NewContext(order int, size int, opts config.Options) *Context {
+	contexts := ABCSize
+	if order == 2 {
+		contexts = 1 << order2Bits
+	}
+
+	return &Context{
+		tables: make([]*Fenwick, contexts),
+		order:  order,
+		size:   size,
+		opts:   opts,
+	}
+}
+
+// table returns table of current context
+func (c *Context) table() *Fenwick {
+	ctx := c.history & 0xFF
+	if c.order == 2 {
+		ctx = ((c.history & 0xFFFF) * 2654435761) >> (32 - order2Bits)
+	}
+
+	t := c.tables[ctx]
+	if t == nil {
+		t = NewFenwick(c.size, c.opts)
+		c.tables[ctx] = t
+	}
+	return t
+}
+
+// Interval returns interval of given symbol in current context
+func (c *Context) Interval(symbol int) (low, high, total uint64) {
+	return c.table().Interval(symbol)
+}
+
+// Total returns sum of all counts in current context
+func (c *Context) Total() uint64 {
+	return c.table().Total()
+}
+
+// Symbol returns symbol with corresponding interval in current context
+func (c *Context) Symbol(interval uint64) int {
+	return c.table().Symbol(interval)
+}
+
+// Update updates symbol count in current context, and moves to the next one
+func (c *Context) Update(symbol int) {
+	c.table().Update(symbol)
+	c.history = c.history<<8 | uint32(symbol&0xFF)
+}
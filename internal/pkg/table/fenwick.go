@@ -0,0 +1,103 @@
+package table
+
+import "github.com/cravtos/arithmetic/internal/pkg/config"
+
+// Fenwick holding counts of characters in binary indexed tree.
+// Unlike Table, its ranges are valid after every update, and both updates and lookups take O(log ABCSize).
+type Fenwick struct {
+	count      [ABCSize + 1]uint64
+	tree       [ABCSize + 2]uint64 // tree[i] holds sum of count[i-(i&-i) : i], indexed from 1
+	totalCount uint64
+	size       int
+	mask       int // the highest power of two not greater than size
+
+	// maxTotalCount is the maximum value of the sum of counts
+	maxTotalCount    uint64
+	countDenominator uint64
+}
+
+// NewFenwick constructs new encoding table for alphabet of size symbols, which is either ABCSize or ABCSize+1
+func NewFenwick(size int, opts config.Options) *Fenwick {
+	t := &Fenwick{
+		size:             size,
+		maxTotalCount:    (1 << opts.CountBitsUsed) - 1,
+		countDenominator: uint64(opts.CountDenominator),
+	}
+	for t.mask = 1; t.mask*2 <= size; t.mask *= 2 {
+	}
+
+	for i := 0; i < size; i++ {
+		t.count[i] = 1
+	}
+	t.rebuild()
+
+	return t
+}
+
+// rebuild recalculates tree and total from counts in O(size)
+func (t *Fenwick) rebuild() {
+	t.totalCount = 0
+	for i := 1; i <= t.size; i++ {
+		t.tree[i] = t.count[i-1]
+		t.totalCount += t.count[i-1]
+	}
+	for i := 1; i <= t.size; i++ {
+		if parent := i + i&-i; parent <= t.size {
+			t.tree[parent] += t.tree[i]
+		}
+	}
+}
+
+// prefix returns sum of counts of symbols less than symbol
+func (t *Fenwick) prefix(symbol int) (sum uint64) {
+	for i := symbol; i > 0; i -= i & -i {
+		sum += t.tree[i]
+	}
+	return sum
+}
+
+// Interval returns interval of given symbol
+func (t *Fenwick) Interval(symbol int) (low, high, total uint64) {
+	low = t.prefix(symbol)
+	return low, low + t.count[symbol], t.totalCount
+}
+
+// Total returns sum of all counts
+func (t *Fenwick) Total() uint64 {
+	return t.totalCount
+}
+
+// Symbol returns symbol with corresponding interval
+func (t *Fenwick) Symbol(interval uint64) int {
+	symbol := 0
+	for step := t.mask; step > 0; step >>= 1 {
+		if next := symbol + step; next <= t.size && t.tree[next] <= interval {
+			symbol = next
+			interval -= t.tree[next]
+		}
+	}
+	return symbol
+}
+
+// Update updates symbol count and normalizes them when t.totalCount >= maxTotalCount
+func (t *Fenwick) Update(symbol int) {
+	t.count[symbol]++
+	t.totalCount++
+
+	if t.totalCount >= t.maxTotalCount {
+		for i := 0; i < t.size; i++ {
+			t.count[i] /= t.countDenominator
+
+			if t.count[i] == 0 {
+				t.count[i] = 1
+			}
+		}
+
+		t.rebuild()
+		return
+	}
+
+	for i := symbol + 1; i <= t.size; i += i & -i {
+		t.tree[i]++
+	}
+}
@@ -0,0 +1,214 @@
+package table
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/model"
+)
+
+// countBits is maximal number of bits in scaled count, it bounds sizes of probability arrays used for coding counts
+const countBits = 64
+
+// Static codes symbols with fixed frequencies counted before coding.
+// Frequencies are coded before the first symbol, so the decoder needs nothing else.
+type Static struct {
+	count    [ABCSize + 1]uint64
+	interval [ABCSize + 2]uint64
+	size     int
+	maxTotal uint64
+
+	// ready is set when frequencies are coded or decoded
+	ready bool
+
+	// Probabilities used for coding counts
+	isZero   [2]model.Prob
+	length   []model.Prob
+	mantissa []model.Prob
+}
+
+// NewStatic constructs static table for alphabet of size symbols, which is either ABCSize or ABCSize+1.
+// Data has to be given to Count before the first symbol is encoded.
+func NewStatic(size int, opts config.Options) *Static {
+	return &Static{
+		size:     size,
+		maxTotal: (1 << opts.CountBitsUsed) - 1,
+		isZero:   [2]model.Prob{model.ProbInit, model.ProbInit},
+		length:   model.NewProbs(countBits),
+		mantissa: model.NewProbs(countBits),
+	}
+}
+
+// Count adds bytes of p to frequencies
+func (t *Static) Count(p []byte) {
+	for _, v := range p {
+		t.count[v]++
+	}
+}
+
+// Restart makes frequencies coded again before the next symbol, so coding can start anew.
+// Counts of data are kept, so it needn't be counted again.
+func (t *Static) Restart() {
+	t.ready = false
+	t.isZero = [2]model.Prob{model.ProbInit, model.ProbInit}
+	t.length = model.NewProbs(countBits)
+	t.mantissa = model.NewProbs(countBits)
+}
+
+// scale makes sum of counts fit into coder, keeping counts of seen symbols non-zero
+func (t *Static) scale() {
+	if t.size > ABCSize {
+		t.count[EOF] = 1
+	}
+
+	var sum uint64
+	for i := 0; i < t.size; i++ {
+		sum += t.count[i]
+	}
+
+	// Every count may be rounded up by 1
+	limit := t.maxTotal - 1 - uint64(t.size)
+	if sum > limit {
+		for i := 0; i < t.size; i++ {
+			if t.count[i] == 0 {
+				continue
+			}
+			t.count[i] = t.count[i] * limit / sum
+			if t.count[i] == 0 {
+				t.count[i] = 1
+			}
+		}
+	}
+}
+
+// ranges calculates intervals of symbols from counts
+func (t *Static) ranges() {
+	for i := 0; i < t.size; i++ {
+		t.interval[i+1] = t.interval[i] + t.count[i]
+	}
+	t.ready = true
+}
+
+// encodeCounts codes counts of bytes: zero flag, and for non-zero counts exp-Golomb code of count-1
+func (t *Static) encodeCounts(e model.Encoder) error {
+	prevZero := 0
+	for i := 0; i < ABCSize; i++ {
+		zero := 0
+		if t.count[i] == 0 {
+			zero = 1
+		}
+		if err := e.EncodeBit(&t.isZero[prevZero], zero); err != nil {
+			return err
+		}
+		prevZero = zero
+		if zero == 1 {
+			continue
+		}
+
+		// count >= 1, and it has n significant bits; n-1 is coded in unary, followed by n-1 lower bits
+		n := bits.Len64(t.count[i])
+		for j := 0; j < n; j++ {
+			bit := 1
+			if j == n-1 {
+				bit = 0
+			}
+			if err := e.EncodeBit(&t.length[j], bit); err != nil {
+				return err
+			}
+		}
+		for j := n - 2; j >= 0; j-- {
+			if err := e.EncodeBit(&t.mantissa[j], int(t.count[i]>>j)&1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decodeCounts decodes counts coded by encodeCounts.
+// Encoder scales them, so count or their sum larger than maxTotal means data is corrupted.
+func (t *Static) decodeCounts(d model.Decoder) error {
+	var sum uint64
+	prevZero := 0
+	for i := 0; i < ABCSize; i++ {
+		zero, err := d.DecodeBit(&t.isZero[prevZero])
+		if err != nil {
+			return err
+		}
+		prevZero = zero
+		if zero == 1 {
+			continue
+		}
+
+		n := 1
+		for ; n < countBits; n++ {
+			bit, err := d.DecodeBit(&t.length[n-1])
+			if err != nil {
+				return err
+			}
+			if bit == 0 {
+				break
+			}
+		}
+
+		count := uint64(1)
+		for j := n - 2; j >= 0; j-- {
+			bit, err := d.DecodeBit(&t.mantissa[j])
+			if err != nil {
+				return err
+			}
+			count = count<<1 | uint64(bit)
+		}
+		if count > t.maxTotal-sum {
+			return fmt.Errorf("%w: count %d of byte %d makes total larger than %d", model.ErrCorrupt, count, i, t.maxTotal)
+		}
+		sum += count
+		t.count[i] = count
+	}
+
+	if t.size > ABCSize {
+		if sum == t.maxTotal {
+			return fmt.Errorf("%w: total of counts is larger than %d", model.ErrCorrupt, t.maxTotal)
+		}
+		t.count[EOF] = 1
+	}
+	return nil
+}
+
+// EncodeSymbol codes frequencies before the first symbol, and then symbol with its fixed interval
+func (t *Static) EncodeSymbol(e model.Encoder, symbol int) error {
+	if !t.ready {
+		t.scale()
+		if err := t.encodeCounts(e); err != nil {
+			return err
+		}
+		t.ranges()
+	}
+
+	return e.Encode(t.interval[symbol], t.interval[symbol+1], t.interval[t.size])
+}
+
+// DecodeSymbol decodes frequencies before the first symbol, and then symbol with its fixed interval
+func (t *Static) DecodeSymbol(d model.Decoder) (int, error) {
+	if !t.ready {
+		if err := t.decodeCounts(d); err != nil {
+			return 0, err
+		}
+		t.ranges()
+	}
+
+	total := t.interval[t.size]
+	freq, err := d.Target(total)
+	if err != nil {
+		return 0, err
+	}
+
+	// The first symbol with interval end greater than freq
+	symbol := sort.Search(t.size, func(i int) bool { return t.interval[i+1] > freq })
+	if err := d.Decode(t.interval[symbol], t.interval[symbol+1], total); err != nil {
+		return 0, err
+	}
+	return symbol, nil
+}
@@ -2,34 +2,59 @@ package table
 
 import "github.com/cravtos/arithmetic/internal/pkg/config"
 
-// maxTotalCount is the maximum value of the sum of counts
-const maxTotalCount uint64 = (1 << config.CountBitsUsed) - 1
-
 // ABCSize is the size of the alphabet
 const ABCSize = 256
 
+// EOF is the symbol marking end of stream.
+// It is a part of the alphabet only for tables constructed by NewTableEOF
+const EOF = ABCSize
+
 // Table holding counts of characters
 type Table struct {
-	count      [ABCSize + 1]uint64
-	interval   [ABCSize + 1]uint64
+	count      [ABCSize + 2]uint64
+	interval   [ABCSize + 2]uint64
 	totalCount uint64
+	size       int
+
+	// maxTotalCount is the maximum value of the sum of counts
+	maxTotalCount    uint64
+	countDenominator uint64
+
+	// updates is number of calls to Update
+	updates          uint64
+	updateRangesRate uint64
 }
 
 // NewTable constructs new encoding table
-func NewTable() *Table {
-	t := &Table{}
-	for i := 1; i <= ABCSize; i++ {
+func NewTable(opts config.Options) *Table {
+	return New(ABCSize, opts)
+}
+
+// NewTableEOF constructs new encoding table with alphabet extended by EOF symbol
+func NewTableEOF(opts config.Options) *Table {
+	return New(ABCSize+1, opts)
+}
+
+// New constructs new encoding table for alphabet of size symbols, which is either ABCSize or ABCSize+1
+func New(size int, opts config.Options) *Table {
+	t := &Table{
+		size:             size,
+		maxTotalCount:    (1 << opts.CountBitsUsed) - 1,
+		countDenominator: uint64(opts.CountDenominator),
+		updateRangesRate: opts.UpdateRangesRate,
+	}
+	for i := 1; i <= size; i++ {
 		t.count[i] = 1
 		t.interval[i] = t.interval[i-1] + t.count[i]
 	}
-	t.totalCount = ABCSize
+	t.totalCount = uint64(size)
 
 	return t
 }
 
 // UpdateRanges makes symbols ranges valid
-func (t *Table) UpdateRanges(fromSymbol uint8) {
-	for i := uint(fromSymbol) + 1; i <= ABCSize; i++ {
+func (t *Table) UpdateRanges(fromSymbol int) {
+	for i := fromSymbol + 1; i <= t.size; i++ {
 		t.interval[i] = t.interval[i-1] + t.count[i]
 	}
 }
@@ -37,15 +62,15 @@ func (t *Table) UpdateRanges(fromSymbol uint8) {
 // UpdateCount updates symbol count and normalizes them when t.totalCount >= maxTotalCount
 // Also updates ranges after normalizing
 // If Table.totalCount is too big, Table.count are normalized
-func (t *Table) UpdateCount(symbol uint8) {
+func (t *Table) UpdateCount(symbol int) {
 	t.count[symbol+1]++
 	t.totalCount++
 
-	if t.totalCount >= maxTotalCount {
+	if t.totalCount >= t.maxTotalCount {
 		t.totalCount = 0
 
-		for i := 1; i <= ABCSize; i++ {
-			t.count[i] /= config.CountDenominator
+		for i := 1; i <= t.size; i++ {
+			t.count[i] /= t.countDenominator
 
 			if t.count[i] == 0 {
 				t.count[i] = 1
@@ -59,16 +84,35 @@ func (t *Table) UpdateCount(symbol uint8) {
 	}
 }
 
+// Update updates symbol count, and its range every UpdateRangesRate calls
+func (t *Table) Update(symbol int) {
+	t.UpdateCount(symbol)
+	t.updates++
+	if t.updates%t.updateRangesRate == 0 {
+		t.UpdateRanges(0)
+	}
+}
+
 // GetInterval returns interval end for given symbol
 func (t *Table) GetInterval(symbol int) uint64 {
 	return t.interval[symbol+1]
 }
 
-// GetSymbol returns symbol with corresponding interval
-func (t *Table) GetSymbol(interval uint64) uint8 {
+// Interval returns interval of given symbol
+func (t *Table) Interval(symbol int) (low, high, total uint64) {
+	return t.interval[symbol], t.interval[symbol+1], t.interval[t.size]
+}
+
+// Total returns interval end of the last symbol
+func (t *Table) Total() uint64 {
+	return t.interval[t.size]
+}
+
+// Symbol returns symbol with corresponding interval
+func (t *Table) Symbol(interval uint64) int {
 	symbol := 1
 	for t.interval[symbol] <= interval {
 		symbol++
 	}
-	return uint8(symbol - 1)
+	return symbol - 1
 }
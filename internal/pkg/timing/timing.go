@@ -0,0 +1,96 @@
+// Package timing measures time spent in phases of coding.
+package timing
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Timings accumulates time spent in reading and writing data, in model and in coder.
+// It is safe for concurrent use, so time of blocks coded in parallel is summed up.
+type Timings struct {
+	io       int64
+	modeling int64
+	coding   int64
+}
+
+// AddIO adds time spent in reading input and writing output
+func (t *Timings) AddIO(d time.Duration) {
+	atomic.AddInt64(&t.io, int64(d))
+}
+
+// AddModeling adds time spent in finding and updating intervals of symbols
+func (t *Timings) AddModeling(d time.Duration) {
+	atomic.AddInt64(&t.modeling, int64(d))
+}
+
+// AddCoding adds time spent in narrowing interval and in its bit input and output
+func (t *Timings) AddCoding(d time.Duration) {
+	atomic.AddInt64(&t.coding, int64(d))
+}
+
+// IO returns time spent in reading input and writing output
+func (t *Timings) IO() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.io))
+}
+
+// Modeling returns time spent in finding and updating intervals of symbols
+func (t *Timings) Modeling() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.modeling))
+}
+
+// Coding returns time spent in narrowing interval and in its bit input and output
+func (t *Timings) Coding() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.coding))
+}
+
+type reader struct {
+	r io.Reader
+	t *Timings
+}
+
+func (r reader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.r.Read(p)
+	r.t.AddIO(time.Since(start))
+	return n, err
+}
+
+type byteReader struct {
+	reader
+	br io.ByteReader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	start := time.Now()
+	c, err := r.br.ReadByte()
+	r.t.AddIO(time.Since(start))
+	return c, err
+}
+
+// Reader returns reader adding time spent in reading r to IO of t.
+// It is io.ByteReader if r is, so it isn't buffered and read past data needed.
+func Reader(r io.Reader, t *Timings) io.Reader {
+	if br, ok := r.(io.ByteReader); ok {
+		return byteReader{reader: reader{r: r, t: t}, br: br}
+	}
+	return reader{r: r, t: t}
+}
+
+type writer struct {
+	w io.Writer
+	t *Timings
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := w.w.Write(p)
+	w.t.AddIO(time.Since(start))
+	return n, err
+}
+
+// Writer returns writer adding time spent in writing to w to IO of t
+func Writer(w io.Writer, t *Timings) io.Writer {
+	return writer{w: w, t: t}
+}
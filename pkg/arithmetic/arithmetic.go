@@ -0,0 +1,353 @@
+// Package arithmetic implements reading and writing of data compressed with adaptive arithmetic coding.
+//
+// Writer and Reader are meant to be used the same way as compress/gzip ones.
+package arithmetic
+
+import (
+	"io"
+
+	coder "github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/model"
+	"github.com/cravtos/arithmetic/internal/pkg/table"
+	"github.com/cravtos/arithmetic/internal/pkg/timing"
+)
+
+var (
+	// ErrHeader is returned when stream doesn't begin with valid header.
+	ErrHeader = coder.ErrHeader
+	// ErrUnsupportedVersion is returned when stream format version is unknown.
+	ErrUnsupportedVersion = coder.ErrUnsupportedVersion
+	// ErrParameters is returned when coder parameters are invalid.
+	ErrParameters = coder.ErrParameters
+	// ErrChecksum is returned when decompressed data doesn't match checksum stored in stream.
+	ErrChecksum = coder.ErrChecksum
+	// ErrModel is returned when model gives invalid intervals, or stream needs custom model which isn't given.
+	ErrModel = coder.ErrModel
+	// ErrCorrupt is returned when compressed data can't be produced by Writer.
+	ErrCorrupt = coder.ErrCorrupt
+	// ErrTruncated is returned when stream ends before all data is decompressed.
+	ErrTruncated = coder.ErrTruncated
+	// ErrLimit is returned when decompressed data exceeds limit set by WithMaxOutput or WithMaxRatio.
+	ErrLimit = coder.ErrLimit
+)
+
+// DecodeError is returned by Reader when decompression fails. It holds position in compressed stream
+// and index of decompressed byte where failure happened, and unwraps to its cause, e.g. ErrCorrupt.
+type DecodeError = coder.DecodeError
+
+// Meta holds optional name, modification time and permissions of original file, recorded in stream header.
+type Meta = coder.Meta
+
+// Info describes compressed stream: format version, coder parameters, size of original data and Meta.
+type Info = coder.Info
+
+// ReadInfo reads header of compressed stream from r and returns its description.
+// Unlike NewReader, it doesn't need custom model the stream is compressed with.
+func ReadInfo(r io.Reader) (Info, error) {
+	return coder.ReadInfo(r)
+}
+
+// Options holds coder parameters. They are recorded in stream header, so Reader needs no configuration.
+type Options = config.Options
+
+// DefaultOptions returns coder parameters used when WithOptions is not given.
+func DefaultOptions() Options {
+	return config.Default()
+}
+
+// Timings accumulates time spent in reading and writing, in model and in coder. See WithTimings.
+type Timings = timing.Timings
+
+// ModelKind selects built-in model. It is recorded in stream header.
+type ModelKind = config.ModelKind
+
+const (
+	// ModelAdaptive is adaptive order-0 model, which ranges are recalculated every UpdateRangesRate symbols.
+	ModelAdaptive = config.ModelAdaptive
+	// ModelFenwick is adaptive order-0 model on binary indexed tree, which ranges are always valid.
+	ModelFenwick = config.ModelFenwick
+	// ModelOrder1 is adaptive order-1 model, which uses previous byte as context.
+	ModelOrder1 = config.ModelOrder1
+	// ModelOrder2 is adaptive order-2 model, which uses hash of two previous bytes as context.
+	ModelOrder2 = config.ModelOrder2
+	// ModelPPM is PPM (prediction by partial matching) model, which blends contexts of orders up to PPMOrder.
+	ModelPPM = config.ModelPPM
+	// ModelBinary is order-1 model, which codes bytes bit by bit with adaptive probabilities.
+	ModelBinary = config.ModelBinary
+	// ModelStatic is two-pass model, which frequencies are counted before coding and stored in stream.
+	// Writer keeps all written data in memory until Close.
+	ModelStatic = config.ModelStatic
+)
+
+// Model gives cumulative frequencies of symbols to the coder, and learns from coded symbols.
+type Model = model.Model
+
+// ModelFactory constructs new Model for alphabet of given size:
+// 256 byte values, followed by EOF symbol when stream size is not known beforehand.
+type ModelFactory = model.Factory
+
+// Coder is a model which codes every symbol as a sequence of one or more intervals or bits,
+// e.g. escapes followed by symbol, or bits of binarized symbol.
+type Coder = model.Coder
+
+// CoderFactory constructs new Coder for alphabet of given size, the same way as ModelFactory.
+type CoderFactory = model.CoderFactory
+
+// Encoder is given to Coder to encode intervals and bits.
+type Encoder = model.Encoder
+
+// Decoder is given to Coder to decode intervals and bits.
+type Decoder = model.Decoder
+
+// Prob is adaptive probability of bit being 0, used by Encoder.EncodeBit and Decoder.DecodeBit.
+type Prob = model.Prob
+
+// ProbInit is probability 1/2, which Prob should be initialized with.
+const ProbInit = model.ProbInit
+
+// EOF is the symbol marking end of stream, when stream size is not known beforehand.
+const EOF = table.EOF
+
+// Option configures Writer or Reader.
+type Option func(*options)
+
+type options struct {
+	size      int64
+	coder     Options
+	model     ModelFactory
+	custom    CoderFactory
+	blockSize uint64
+	seekable  bool
+	workers   int
+	maxOutput uint64
+	maxRatio  uint64
+	timings   *Timings
+}
+
+func newOptions(opts []Option) options {
+	o := options{size: -1, coder: config.Default()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.model != nil {
+		o.coder.Model = o.model
+	}
+	if o.custom != nil {
+		o.coder.Coder = o.custom
+	}
+	if o.blockSize != 0 {
+		o.coder.BlockSize = o.blockSize
+	}
+	if o.seekable {
+		o.coder.Seekable = true
+	}
+	if o.workers != 0 {
+		o.coder.Workers = o.workers
+	}
+	if o.maxOutput != 0 {
+		o.coder.MaxOutput = o.maxOutput
+	}
+	if o.maxRatio != 0 {
+		o.coder.MaxRatio = o.maxRatio
+	}
+	if o.timings != nil {
+		o.coder.Timings = o.timings
+	}
+	return o
+}
+
+// WithOptions sets coder parameters. Invalid parameters are reported by Write or Close.
+// Reader uses only Workers, MaxOutput, MaxRatio, Timings and custom model out of them.
+func WithOptions(opts Options) Option {
+	return func(o *options) {
+		o.coder = opts
+	}
+}
+
+// WithSize declares number of bytes which will be written to Writer, and stores it in stream header.
+// Without it the end of stream is marked by special EOF symbol. It has no effect on Reader.
+func WithSize(size int64) Option {
+	return func(o *options) {
+		o.size = size
+	}
+}
+
+// WithModel makes coder use custom model instead of adaptive order-0 one.
+// The model isn't recorded in stream, so Reader has to be given the same one.
+func WithModel(f ModelFactory) Option {
+	return func(o *options) {
+		o.model = f
+	}
+}
+
+// WithCoder makes coder use custom Coder instead of adaptive order-0 model.
+// The model isn't recorded in stream, so Reader has to be given the same one.
+func WithCoder(f CoderFactory) Option {
+	return func(o *options) {
+		o.custom = f
+	}
+}
+
+// WithBlockSize splits data into independently coded blocks of given size,
+// so they can be compressed and decompressed in parallel. It has no effect on Reader.
+func WithBlockSize(size uint64) Option {
+	return func(o *options) {
+		o.blockSize = size
+	}
+}
+
+// WithSeekable splits data into blocks of given size, and adds index of them to the end of stream,
+// so it can be read at any position by SeekableReader. It has no effect on Reader.
+func WithSeekable(blockSize uint64) Option {
+	return func(o *options) {
+		o.blockSize = blockSize
+		o.seekable = true
+	}
+}
+
+// WithWorkers sets number of blocks compressed or decompressed in parallel.
+// By default number of CPUs is used.
+func WithWorkers(n int) Option {
+	return func(o *options) {
+		o.workers = n
+	}
+}
+
+// WithMaxOutput makes Reader fail with ErrLimit when more than n bytes are decompressed.
+// By default output is not limited.
+func WithMaxOutput(n uint64) Option {
+	return func(o *options) {
+		o.maxOutput = n
+	}
+}
+
+// WithMaxRatio makes Reader fail with ErrLimit when decompressed data grows more than ratio times
+// larger than compressed data read. The first MiB of output is not limited by it.
+// By default ratio is not limited.
+func WithMaxRatio(ratio uint64) Option {
+	return func(o *options) {
+		o.maxRatio = ratio
+	}
+}
+
+// WithTimings makes Writer or Reader add time spent in phases of coding to t.
+// Measuring slows coding down.
+func WithTimings(t *Timings) Option {
+	return func(o *options) {
+		o.timings = t
+	}
+}
+
+// Writer is an io.WriteCloser. Writes to a Writer are compressed and written to underlying writer.
+type Writer struct {
+	opts options
+	z    *coder.Writer
+}
+
+// NewWriter returns a new Writer. Writes to the returned writer are compressed and written to w.
+//
+// It is the caller's responsibility to call Close on the Writer when done.
+func NewWriter(w io.Writer, opts ...Option) *Writer {
+	z := &Writer{opts: newOptions(opts)}
+	z.z = coder.NewWriter(w, z.opts.size, z.opts.coder)
+	return z
+}
+
+// Write writes a compressed form of p to the underlying io.Writer.
+func (z *Writer) Write(p []byte) (int, error) {
+	return z.z.Write(p)
+}
+
+// SetMeta records information about original file in stream header. It has to be called before the first Write.
+func (z *Writer) SetMeta(m Meta) {
+	z.z.SetMeta(m)
+}
+
+// Close finishes compressed stream. It does not close the underlying io.Writer.
+func (z *Writer) Close() error {
+	return z.z.Close()
+}
+
+// Reset discards the Writer's state and makes it equivalent to the result of NewWriter
+// with the same options, but writing to w instead.
+func (z *Writer) Reset(w io.Writer) {
+	z.z.Reset(w, z.opts.size, z.opts.coder)
+}
+
+// Reader is an io.ReadCloser. Reads from a Reader return decompressed data read from underlying reader.
+// Data is returned as it is decompressed, so it is verified by checksums only when the end of stream is reached.
+// Checksums of blocks in index of seekable stream are verified then too, since the index follows blocks.
+type Reader struct {
+	opts options
+	z    *coder.Reader
+}
+
+// NewReader creates a new Reader reading the given reader. Header of the stream is read immediately.
+//
+// It is the caller's responsibility to call Close on the Reader when done.
+func NewReader(r io.Reader, opts ...Option) (*Reader, error) {
+	z := &Reader{opts: newOptions(opts)}
+	var err error
+	if z.z, err = coder.NewReader(r, z.opts.coder); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// Meta returns information about original file recorded in stream header.
+func (z *Reader) Meta() Meta {
+	return z.z.Meta()
+}
+
+// Read reads decompressed data from the underlying io.Reader.
+func (z *Reader) Read(p []byte) (int, error) {
+	return z.z.Read(p)
+}
+
+// Close does not close the underlying io.Reader.
+func (z *Reader) Close() error {
+	return z.z.Close()
+}
+
+// Reset discards the Reader's state and makes it equivalent to the result of NewReader
+// with the same options, but reading from r instead.
+func (z *Reader) Reset(r io.Reader) error {
+	return z.z.Reset(r, z.opts.coder)
+}
+
+// SeekableReader is an io.ReaderAt and io.ReadSeeker over decompressed data of stream written with WithSeekable.
+// Only blocks containing requested data are decompressed.
+type SeekableReader struct {
+	z *coder.SeekableReader
+}
+
+// NewSeekableReader creates a new SeekableReader reading stream of given size from r.
+// Header and index of the stream are read immediately.
+func NewSeekableReader(r io.ReaderAt, size int64, opts ...Option) (*SeekableReader, error) {
+	z, err := coder.NewSeekableReader(r, size, newOptions(opts).coder)
+	if err != nil {
+		return nil, err
+	}
+	return &SeekableReader{z: z}, nil
+}
+
+// Size returns number of bytes of decompressed data.
+func (z *SeekableReader) Size() int64 {
+	return z.z.Size()
+}
+
+// ReadAt reads len(p) bytes of decompressed data starting at offset off. It is safe for concurrent use.
+func (z *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	return z.z.ReadAt(p, off)
+}
+
+// Read reads decompressed data starting at position set by Seek.
+func (z *SeekableReader) Read(p []byte) (int, error) {
+	return z.z.Read(p)
+}
+
+// Seek sets position of the next Read in decompressed data.
+func (z *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	return z.z.Seek(offset, whence)
+}
@@ -0,0 +1,160 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cravtos/arithmetic/internal/pkg/archive"
+	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+)
+
+// TestArchive stores directory tree in archive, and extracts it to another directory.
+func TestArchive(t *testing.T) {
+	src := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	files := map[string]string{
+		"tree/a.txt":          "hello",
+		"tree/empty":          "",
+		"tree/sub/deep/b.txt": "world",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Symlinks are skipped instead of aborting archive
+	if err := os.Symlink("a.txt", filepath.Join(src, "tree", "link")); err != nil {
+		t.Fatal(err)
+	}
+	var skipped []error
+	enc := &bytes.Buffer{}
+	if err := archive.Create(enc, []string{filepath.Join(src, "tree")}, config.Default(), func(err error) {
+		skipped = append(skipped, err)
+	}); err != nil {
+		t.Fatalf("got error while creating archive: %v\n", err)
+	}
+	if len(skipped) != 1 || !errors.Is(skipped[0], archive.ErrUnsupported) {
+		t.Errorf("got skipped files %v, want the symlink", skipped)
+	}
+
+	entries, err := archive.List(bytes.NewReader(enc.Bytes()), config.Default())
+	if err != nil {
+		t.Fatalf("got error while listing archive: %v\n", err)
+	}
+	if len(entries) != 6 {
+		t.Errorf("got %d entries, want 6", len(entries))
+	}
+
+	dst := t.TempDir()
+	if err := archive.Extract(bytes.NewReader(enc.Bytes()), dst, config.Default(), false); err != nil {
+		t.Fatalf("got error while extracting archive: %v\n", err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dst, filepath.FromSlash(name))
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("got error while reading extracted file: %v\n", err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: got content %q, want %q", name, got, content)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+			t.Errorf("%s: got mode %v and mtime %v, want %v and %v", name, info.Mode().Perm(), info.ModTime(), os.FileMode(0640), mtime)
+		}
+	}
+}
+
+// TestArchiveTraversal checks that entries leading out of destination directory are rejected.
+func TestArchiveTraversal(t *testing.T) {
+	for _, name := range []string{"../evil", "/evil", "a/../../evil", "a//b", "link/evil", "link"} {
+		raw := &bytes.Buffer{}
+		raw.WriteString("ARCH\x01\x01")
+		raw.WriteByte(byte(len(name)))
+		raw.WriteString(name)
+		raw.WriteString("\x80\x03\x00\x01x\x00") // mode 0600, mtime 0, size 1, content, end of archive
+
+		enc := &bytes.Buffer{}
+		if err := arithmetic.Encode(raw, enc, config.Default()); err != nil {
+			t.Fatalf("got error while encoding: %v\n", err)
+		}
+
+		// Symlink already in destination leads out of it
+		tmp := t.TempDir()
+		dst := filepath.Join(tmp, "dst")
+		outside := filepath.Join(tmp, "outside")
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(outside, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(outside, filepath.Join(dst, "link")); err != nil {
+			t.Fatal(err)
+		}
+
+		err := archive.Extract(enc, dst, config.Default(), false)
+		if !errors.Is(err, archive.ErrInsecurePath) {
+			t.Errorf("%q: got error %v, want %v", name, err, archive.ErrInsecurePath)
+		}
+		if written, _ := ioutil.ReadDir(outside); len(written) != 0 {
+			t.Errorf("%q: got %d files written out of destination", name, len(written))
+		}
+	}
+}
+
+// TestArchiveOverwrite checks that existing files are refused, and with overwrite are replaced
+// without writing through hard links to files out of destination.
+func TestArchiveOverwrite(t *testing.T) {
+	raw := &bytes.Buffer{}
+	raw.WriteString("ARCH\x01\x01\x01x\x80\x03\x00\x01y\x00") // file "x" with mode 0600, mtime 0, content "y", end of archive
+	enc := &bytes.Buffer{}
+	if err := arithmetic.Encode(raw, enc, config.Default()); err != nil {
+		t.Fatalf("got error while encoding: %v\n", err)
+	}
+
+	tmp := t.TempDir()
+	dst := filepath.Join(tmp, "dst")
+	outside := filepath.Join(tmp, "outside")
+	if err := os.Mkdir(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(outside, []byte("outside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(outside, filepath.Join(dst, "x")); err != nil {
+		t.Skipf("hard links aren't supported: %v", err)
+	}
+
+	err := archive.Extract(bytes.NewReader(enc.Bytes()), dst, config.Default(), false)
+	if !errors.Is(err, os.ErrExist) {
+		t.Errorf("got error %v, want %v", err, os.ErrExist)
+	}
+	if err := archive.Extract(bytes.NewReader(enc.Bytes()), dst, config.Default(), true); err != nil {
+		t.Fatalf("got error while extracting archive with overwrite: %v\n", err)
+	}
+
+	if got, _ := ioutil.ReadFile(outside); string(got) != "outside" {
+		t.Errorf("got file out of destination changed to %q", got)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(dst, "x")); string(got) != "y" {
+		t.Errorf("got extracted content %q, want %q", got, "y")
+	}
+}
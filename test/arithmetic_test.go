@@ -1,10 +1,14 @@
 package test
 
 import (
+	"bytes"
 	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
 	"github.com/cravtos/arithmetic/internal/pkg/helpers"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -17,6 +21,9 @@ func TestArithmetic(t *testing.T) {
 	}
 
 	for _, file := range testFiles {
+		if file.IsDir() {
+			continue
+		}
 		file := file
 		t.Run(file.Name(), func(t *testing.T) {
 			t.Parallel()
@@ -52,7 +59,7 @@ func cmpEncodeAndDecode(t *testing.T, file string) (equal bool, err error) {
 	defer encFile.Close()
 	defer os.Remove(encName)
 
-	err = arithmetic.Encode(origFile, encFile)
+	err = arithmetic.Encode(origFile, encFile, config.Default())
 	if err != nil {
 		return false, err
 	}
@@ -72,7 +79,7 @@ func cmpEncodeAndDecode(t *testing.T, file string) (equal bool, err error) {
 	defer decFile.Close()
 	defer os.Remove(decName)
 
-	err = arithmetic.Decode(encFile, decFile)
+	err = arithmetic.Decode(encFile, decFile, config.Default())
 	if err != nil {
 		return false, err
 	}
@@ -94,3 +101,97 @@ func cmpEncodeAndDecode(t *testing.T, file string) (equal bool, err error) {
 	}
 	return equal, nil
 }
+
+// TestArithmeticStream encodes and decodes every file in test/testdata through readers of unknown length.
+func TestArithmeticStream(t *testing.T) {
+	testFiles, err := ioutil.ReadDir("./testdata")
+	if err != nil {
+		t.Errorf("got error while getting testdata: %v\n", err)
+		t.FailNow()
+	}
+
+	for _, file := range testFiles {
+		if file.IsDir() {
+			continue
+		}
+		file := file
+		t.Run(file.Name(), func(t *testing.T) {
+			t.Parallel()
+			orig, err := ioutil.ReadFile("./testdata/" + file.Name())
+			if err != nil {
+				t.Fatalf("got error while reading testdata: %v\n", err)
+			}
+
+			// Hide Len() method of bytes.Reader, so the length is unknown to encoder
+			enc := &bytes.Buffer{}
+			err = arithmetic.Encode(struct{ io.Reader }{bytes.NewReader(orig)}, enc, config.Default())
+			if err != nil {
+				t.Fatalf("got error while encoding: %v\n", err)
+			}
+
+			dec := &bytes.Buffer{}
+			err = arithmetic.Decode(struct{ io.Reader }{enc}, dec, config.Default())
+			if err != nil {
+				t.Fatalf("got error while decoding: %v\n", err)
+			}
+
+			if !bytes.Equal(orig, dec.Bytes()) {
+				t.Error("original and decoded data are not equal")
+			}
+		})
+	}
+}
+
+// TestCreateDecoded checks that output file named by original name doesn't overwrite compressed or existing file.
+func TestCreateDecoded(t *testing.T) {
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "data.txt")
+	enc := &bytes.Buffer{}
+	w := arithmetic.NewWriter(enc, -1, config.Default())
+	w.SetMeta(arithmetic.Meta{Name: "data.txt"})
+	if _, err := w.Write([]byte("data")); err != nil {
+		t.Fatalf("got error while writing: %v\n", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("got error while closing writer: %v\n", err)
+	}
+	if err := ioutil.WriteFile(inPath, enc.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compressed file is named by original name, or linked to it
+	outPath, err := helpers.StoredPath(inPath, "data.txt")
+	if err != nil {
+		t.Fatalf("got error while getting stored path: %v\n", err)
+	}
+	linkPath := filepath.Join(dir, "link.txt")
+	if err := os.Link(inPath, linkPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{outPath, linkPath} {
+		if f, err := helpers.CreateDecoded(inPath, path, true); err == nil {
+			f.Close()
+			t.Errorf("%s: creating output over compressed file succeeded", path)
+		}
+	}
+	if got, err := ioutil.ReadFile(inPath); err != nil || !bytes.Equal(got, enc.Bytes()) {
+		t.Errorf("compressed file is changed: %v", err)
+	}
+
+	otherPath := filepath.Join(dir, "other.txt")
+	if err := ioutil.WriteFile(otherPath, []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := helpers.CreateDecoded(inPath, otherPath, false); err == nil {
+		f.Close()
+		t.Error("overwriting existing file without force succeeded")
+	}
+	if got, err := ioutil.ReadFile(otherPath); err != nil || string(got) != "other" {
+		t.Errorf("existing file is changed: %v", err)
+	}
+	f, err := helpers.CreateDecoded(inPath, otherPath, true)
+	if err != nil {
+		t.Fatalf("got error while overwriting existing file with force: %v\n", err)
+	}
+	f.Close()
+}
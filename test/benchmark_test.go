@@ -0,0 +1,252 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/model"
+)
+
+// benchData returns 1 MiB of text-like data, which statistics change from section to section.
+func benchData() []byte {
+	const size = 1 << 20
+	const section = 64 << 10
+	rnd := rand.New(rand.NewSource(1))
+
+	data := make([]byte, 0, size+64)
+	for len(data) < size {
+		// Every section has its own vocabulary of words made from its own letters
+		letters := []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+		rnd.Shuffle(len(letters), func(i, j int) { letters[i], letters[j] = letters[j], letters[i] })
+		letters = letters[:8+rnd.Intn(16)]
+
+		words := make([][]byte, 200)
+		for i := range words {
+			words[i] = make([]byte, 1+rnd.Intn(8))
+			for j := range words[i] {
+				words[i][j] = letters[rnd.Intn(len(letters))]
+			}
+		}
+
+		zipf := rand.NewZipf(rnd, 1.2, 1, uint64(len(words)-1))
+		for end := len(data) + section; len(data) < end; {
+			data = append(data, words[zipf.Uint64()]...)
+			data = append(data, " \n"[rnd.Intn(2)])
+		}
+	}
+	return data[:size]
+}
+
+// benchConfig is a coder configuration compared by benchmarks
+type benchConfig struct {
+	name string
+	opts config.Options
+}
+
+func benchConfigs() []benchConfig {
+	adaptive := config.Default()
+	exact := adaptive
+	exact.UpdateRangesRate = 1
+	fenwick := adaptive
+	fenwick.ModelKind = config.ModelFenwick
+	order1 := adaptive
+	order1.ModelKind = config.ModelOrder1
+	order2 := adaptive
+	order2.ModelKind = config.ModelOrder2
+	ppm := adaptive
+	ppm.ModelKind = config.ModelPPM
+	binary := adaptive
+	binary.ModelKind = config.ModelBinary
+	static := adaptive
+	static.ModelKind = config.ModelStatic
+	blocks := adaptive
+	blocks.BlockSize = 128 << 10
+
+	return []benchConfig{
+		{"adaptive", adaptive},
+		{"adaptive-exact", exact},
+		{"fenwick", fenwick},
+		{"order1", order1},
+		{"order2", order2},
+		{"ppm", ppm},
+		{"binary", binary},
+		{"static", static},
+		{"blocks", blocks},
+	}
+}
+
+// BenchmarkEncode measures compression throughput, and reports compression ratio of every model.
+func BenchmarkEncode(b *testing.B) {
+	data := benchData()
+	for _, bc := range benchConfigs() {
+		opts := bc.opts
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			enc := &bytes.Buffer{}
+			for i := 0; i < b.N; i++ {
+				enc.Reset()
+				if err := arithmetic.Encode(bytes.NewReader(data), enc, opts); err != nil {
+					b.Fatalf("got error while encoding: %v\n", err)
+				}
+			}
+			b.ReportMetric(float64(len(data))/float64(enc.Len()), "ratio")
+		})
+	}
+}
+
+// BenchmarkDecode measures decompression throughput of every model.
+func BenchmarkDecode(b *testing.B) {
+	data := benchData()
+	for _, bc := range benchConfigs() {
+		opts := bc.opts
+		enc := &bytes.Buffer{}
+		if err := arithmetic.Encode(bytes.NewReader(data), enc, opts); err != nil {
+			b.Fatalf("got error while encoding: %v\n", err)
+		}
+
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			dec := &bytes.Buffer{}
+			for i := 0; i < b.N; i++ {
+				dec.Reset()
+				if err := arithmetic.Decode(bytes.NewReader(enc.Bytes()), dec, opts); err != nil {
+					b.Fatalf("got error while decoding: %v\n", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDecodeFile measures end-to-end decompression of file into file, the way decompress command does it,
+// so reading, modeling, coding and writing are all taken into account.
+func BenchmarkDecodeFile(b *testing.B) {
+	data := benchData()
+	dir := b.TempDir()
+	for _, bc := range benchConfigs() {
+		opts := bc.opts
+		enc := &bytes.Buffer{}
+		if err := arithmetic.Encode(bytes.NewReader(data), enc, opts); err != nil {
+			b.Fatalf("got error while encoding: %v\n", err)
+		}
+		inPath := filepath.Join(dir, bc.name+".ari")
+		if err := ioutil.WriteFile(inPath, enc.Bytes(), 0644); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if err := decodeFile(inPath, filepath.Join(dir, bc.name), opts); err != nil {
+					b.Fatalf("got error while decoding: %v\n", err)
+				}
+			}
+		})
+	}
+}
+
+// decodeFile decompresses file at inPath into file at outPath
+func decodeFile(inPath string, outPath string, opts config.Options) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	r, err := arithmetic.NewReader(in, opts)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// fixedCoder codes symbols with fixed frequencies, so benchmarks of it measure the coder alone
+type fixedCoder struct {
+	cum    []uint64 // cumulative frequencies, symbol s has interval [cum[s], cum[s+1])
+	symbol []uint16 // symbol of every frequency
+}
+
+// newFixedCoder returns fixedCoder with frequencies of symbols in data, scaled to about 1<<15
+func newFixedCoder(data []byte, symbols int) *fixedCoder {
+	counts := make([]uint64, symbols)
+	for _, v := range data {
+		counts[v]++
+	}
+	c := &fixedCoder{cum: make([]uint64, symbols+1)}
+	for s, n := range counts {
+		freq := n*(1<<15)/uint64(len(data)+1) + 1
+		c.cum[s+1] = c.cum[s] + freq
+		for i := uint64(0); i < freq; i++ {
+			c.symbol = append(c.symbol, uint16(s))
+		}
+	}
+	return c
+}
+
+func (c *fixedCoder) EncodeSymbol(e model.Encoder, symbol int) error {
+	return e.Encode(c.cum[symbol], c.cum[symbol+1], c.cum[len(c.cum)-1])
+}
+
+func (c *fixedCoder) DecodeSymbol(d model.Decoder) (int, error) {
+	total := c.cum[len(c.cum)-1]
+	freq, err := d.Target(total)
+	if err != nil {
+		return 0, err
+	}
+	symbol := int(c.symbol[freq])
+	return symbol, d.Decode(c.cum[symbol], c.cum[symbol+1], total)
+}
+
+// BenchmarkCoder measures throughput of coder and its bit input and output, with model taking no time.
+func BenchmarkCoder(b *testing.B) {
+	data := benchData()
+	opts := config.Default()
+	opts.Coder = func(symbols int) model.Coder {
+		return newFixedCoder(data, symbols)
+	}
+	enc := &bytes.Buffer{}
+	if err := arithmetic.Encode(bytes.NewReader(data), enc, opts); err != nil {
+		b.Fatalf("got error while encoding: %v\n", err)
+	}
+
+	b.Run("encode", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		out := &bytes.Buffer{}
+		for i := 0; i < b.N; i++ {
+			out.Reset()
+			if err := arithmetic.Encode(bytes.NewReader(data), out, opts); err != nil {
+				b.Fatalf("got error while encoding: %v\n", err)
+			}
+		}
+		b.ReportMetric(float64(len(data))/float64(out.Len()), "ratio")
+	})
+	b.Run("decode", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		out := &bytes.Buffer{}
+		for i := 0; i < b.N; i++ {
+			out.Reset()
+			if err := arithmetic.Decode(bytes.NewReader(enc.Bytes()), out, opts); err != nil {
+				b.Fatalf("got error while decoding: %v\n", err)
+			}
+		}
+	})
+}
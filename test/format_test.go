@@ -0,0 +1,597 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/bits"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+	"github.com/cravtos/arithmetic/internal/pkg/model"
+	"github.com/cravtos/arithmetic/internal/pkg/table"
+)
+
+// TestHeader checks that Decode rejects streams with damaged header.
+func TestHeader(t *testing.T) {
+	enc := &bytes.Buffer{}
+	if err := arithmetic.Encode(bytes.NewReader([]byte("header")), enc, config.Default()); err != nil {
+		t.Fatalf("got error while encoding: %v\n", err)
+	}
+
+	tests := []struct {
+		name   string
+		offset int
+		value  byte
+		want   error
+	}{
+		{"magic", 0, 'Z', arithmetic.ErrHeader},
+		{"version", 4, 100, arithmetic.ErrUnsupportedVersion},
+		{"flags", 5, 0xFF, arithmetic.ErrHeader},
+		{"model", 6, 17, arithmetic.ErrHeader},
+		{"interval bits", 7, 17, arithmetic.ErrParameters},
+		{"count bits", 8, 40, arithmetic.ErrParameters},
+		{"count denominator", 9, 1, arithmetic.ErrParameters},
+		{"update rate", 10, 0, arithmetic.ErrParameters},
+	}
+
+	for _, tt := range tests {
+		damaged := append([]byte(nil), enc.Bytes()...)
+		damaged[tt.offset] = tt.value
+
+		err := arithmetic.Decode(bytes.NewReader(damaged), &bytes.Buffer{}, config.Default())
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	err := arithmetic.Decode(bytes.NewReader(enc.Bytes()[:3]), &bytes.Buffer{}, config.Default())
+	if !errors.Is(err, arithmetic.ErrHeader) {
+		t.Errorf("short header: got error %v, want %v", err, arithmetic.ErrHeader)
+	}
+}
+
+// TestChecksum checks that Decode detects damaged checksum trailer.
+func TestChecksum(t *testing.T) {
+	enc := &bytes.Buffer{}
+	if err := arithmetic.Encode(bytes.NewReader([]byte("checksum")), enc, config.Default()); err != nil {
+		t.Fatalf("got error while encoding: %v\n", err)
+	}
+
+	damaged := enc.Bytes()
+	damaged[len(damaged)-1] ^= 1
+
+	err := arithmetic.Decode(bytes.NewReader(damaged), &bytes.Buffer{}, config.Default())
+	if !errors.Is(err, arithmetic.ErrChecksum) {
+		t.Errorf("got error %v, want %v", err, arithmetic.ErrChecksum)
+	}
+}
+
+// TestOptions encodes and decodes data with non-default coder parameters.
+func TestOptions(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/repeating.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	tests := []config.Options{
+		{IntervalBitsUsed: 40, CountDenominator: 3, CountBitsUsed: 20, UpdateRangesRate: 1},
+		{IntervalBitsUsed: 12, CountDenominator: 255, CountBitsUsed: 10, UpdateRangesRate: 7},
+		{IntervalBitsUsed: 32, CountDenominator: 2, CountBitsUsed: 12, UpdateRangesRate: 1, ModelKind: config.ModelFenwick},
+		{IntervalBitsUsed: 32, CountDenominator: 2, CountBitsUsed: 16, UpdateRangesRate: 1, ModelKind: config.ModelOrder1},
+		{IntervalBitsUsed: 20, CountDenominator: 4, CountBitsUsed: 11, UpdateRangesRate: 1, ModelKind: config.ModelOrder2},
+		{IntervalBitsUsed: 32, CountDenominator: 2, CountBitsUsed: 16, UpdateRangesRate: 1, ModelKind: config.ModelPPM, PPMOrder: 5, PPMMemory: 1},
+		{IntervalBitsUsed: 24, CountDenominator: 3, CountBitsUsed: 10, UpdateRangesRate: 1, ModelKind: config.ModelPPM, PPMOrder: 0, PPMMemory: 1},
+		{IntervalBitsUsed: 14, CountDenominator: 2, CountBitsUsed: 10, UpdateRangesRate: 1, ModelKind: config.ModelBinary},
+		{IntervalBitsUsed: 14, CountDenominator: 2, CountBitsUsed: 10, UpdateRangesRate: 1, ModelKind: config.ModelStatic},
+		{IntervalBitsUsed: 53, CountDenominator: 2, CountBitsUsed: 10, UpdateRangesRate: 1},
+		{IntervalBitsUsed: 51, CountDenominator: 2, CountBitsUsed: 10, UpdateRangesRate: 1, ModelKind: config.ModelBinary},
+		{IntervalBitsUsed: 51, CountDenominator: 2, CountBitsUsed: 12, UpdateRangesRate: 1, ModelKind: config.ModelStatic},
+		{IntervalBitsUsed: 32, CountDenominator: 2, CountBitsUsed: 16, UpdateRangesRate: 1000, BlockSize: 100, Workers: 3},
+		{IntervalBitsUsed: 32, CountDenominator: 2, CountBitsUsed: 16, UpdateRangesRate: 1, ModelKind: config.ModelStatic, BlockSize: 64},
+	}
+
+	for _, opts := range tests {
+		enc := &bytes.Buffer{}
+		if err := arithmetic.Encode(bytes.NewReader(orig), enc, opts); err != nil {
+			t.Fatalf("%+v: got error while encoding: %v\n", opts, err)
+		}
+
+		dec := &bytes.Buffer{}
+		if err := arithmetic.Decode(enc, dec, config.Default()); err != nil {
+			t.Fatalf("%+v: got error while decoding: %v\n", opts, err)
+		}
+		if !bytes.Equal(orig, dec.Bytes()) {
+			t.Errorf("%+v: original and decoded data are not equal", opts)
+		}
+	}
+
+	for _, invalid := range []config.Options{
+		{IntervalBitsUsed: 16, CountDenominator: 2, CountBitsUsed: 16, UpdateRangesRate: 1},
+		// Bit probabilities would overflow interval arithmetic
+		{IntervalBitsUsed: 53, CountDenominator: 2, CountBitsUsed: 10, UpdateRangesRate: 1, ModelKind: config.ModelBinary},
+		{IntervalBitsUsed: 52, CountDenominator: 2, CountBitsUsed: 10, UpdateRangesRate: 1, ModelKind: config.ModelStatic},
+	} {
+		err = arithmetic.Encode(bytes.NewReader(orig), &bytes.Buffer{}, invalid)
+		if !errors.Is(err, arithmetic.ErrParameters) {
+			t.Errorf("%+v: got error %v, want %v", invalid, err, arithmetic.ErrParameters)
+		}
+	}
+}
+
+// TestStored checks that incompressible data expands only by header, frames of chunks or blocks, and index.
+func TestStored(t *testing.T) {
+	// Data is split into chunks of 128 KiB, when block size isn't given
+	large := make([]byte, 1<<20+12345)
+	rand.New(rand.NewSource(1)).Read(large)
+	orig := large[:100000]
+
+	tests := []config.Options{config.Default(), config.Default(), config.Default()}
+	tests[1].BlockSize = 30000
+	tests[2].BlockSize = 30000
+	tests[2].Seekable = true
+
+	for _, opts := range tests {
+		inputs := [][]byte{orig, orig[:1], nil}
+		blockSize := int(opts.BlockSize)
+		if blockSize == 0 {
+			inputs = append(inputs, large)
+			blockSize = 128 << 10
+		}
+		for _, data := range inputs {
+			enc := &bytes.Buffer{}
+			if err := arithmetic.Encode(bytes.NewReader(data), enc, opts); err != nil {
+				t.Fatalf("%+v: got error while encoding: %v\n", opts, err)
+			}
+			// Every block adds at most 24 bytes of frame and index entry
+			limit := len(data) + 160 + 24*(len(data)/blockSize+1)
+			if enc.Len() > limit {
+				t.Errorf("%+v: %d bytes are expanded to %d", opts, len(data), enc.Len())
+			}
+
+			// Size is unknown beforehand
+			unsized := &bytes.Buffer{}
+			if err := arithmetic.Encode(io.MultiReader(bytes.NewReader(data)), unsized, opts); err != nil {
+				t.Fatalf("%+v: got error while encoding: %v\n", opts, err)
+			}
+			if unsized.Len() > limit {
+				t.Errorf("%+v: %d bytes of unknown size are expanded to %d", opts, len(data), unsized.Len())
+			}
+			dec := &bytes.Buffer{}
+			if err := arithmetic.Decode(unsized, dec, config.Default()); err != nil {
+				t.Fatalf("%+v: got error while decoding: %v\n", opts, err)
+			}
+			if !bytes.Equal(data, dec.Bytes()) {
+				t.Errorf("%+v: original and decoded data of unknown size are not equal", opts)
+			}
+
+			dec.Reset()
+			if err := arithmetic.Decode(enc, dec, config.Default()); err != nil {
+				t.Fatalf("%+v: got error while decoding: %v\n", opts, err)
+			}
+			if !bytes.Equal(data, dec.Bytes()) {
+				t.Errorf("%+v: original and decoded data are not equal", opts)
+			}
+		}
+	}
+}
+
+// TestChunks codes text around random data, so chunks are both coded and stored, with every model.
+// Chunks have to be written out as they are full, not held back until Close.
+func TestChunks(t *testing.T) {
+	text := randomText(140 << 10)
+	noise := make([]byte, 140<<10)
+	rand.New(rand.NewSource(2)).Read(noise)
+	data := append(append(append([]byte(nil), text...), noise...), text...)
+
+	for model := config.ModelAdaptive; model <= config.ModelStatic; model++ {
+		opts := config.Default()
+		opts.ModelKind = model
+		for _, size := range []int64{-1, int64(len(data))} {
+			enc := &bytes.Buffer{}
+			w := arithmetic.NewWriter(enc, size, opts)
+			if _, err := w.Write(text); err != nil {
+				t.Fatalf("%v: size %d: got error while writing: %v\n", model, size, err)
+			}
+			// Static model needs all data counted before coding
+			if enc.Len() < 1000 && model != config.ModelStatic {
+				t.Errorf("%v: size %d: %d bytes are written after %d bytes of text", model, size, enc.Len(), len(text))
+			}
+			if _, err := w.Write(data[len(text):]); err != nil {
+				t.Fatalf("%v: size %d: got error while writing: %v\n", model, size, err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("%v: size %d: got error while closing writer: %v\n", model, size, err)
+			}
+			if enc.Len() > len(data)-len(text)/4 {
+				t.Errorf("%v: size %d: %d bytes are coded with %d bytes", model, size, len(data), enc.Len())
+			}
+
+			dec := &bytes.Buffer{}
+			if err := arithmetic.Decode(enc, dec, config.Default()); err != nil {
+				t.Fatalf("%v: size %d: got error while decoding: %v\n", model, size, err)
+			}
+			if !bytes.Equal(data, dec.Bytes()) {
+				t.Errorf("%v: size %d: original and decoded data are not equal", model, size)
+			}
+		}
+	}
+}
+
+// TestDecodeError checks that decoding errors hold their cause and position.
+func TestDecodeError(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/repeating.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	blocks := config.Default()
+	blocks.BlockSize = 500
+	for _, opts := range []config.Options{config.Default(), blocks} {
+		enc := &bytes.Buffer{}
+		if err := arithmetic.Encode(bytes.NewReader(orig), enc, opts); err != nil {
+			t.Fatalf("got error while encoding: %v\n", err)
+		}
+
+		half := enc.Len() / 2
+		err := arithmetic.Decode(bytes.NewReader(enc.Bytes()[:half]), &bytes.Buffer{}, config.Default())
+		var de *arithmetic.DecodeError
+		if !errors.Is(err, arithmetic.ErrTruncated) || !errors.As(err, &de) {
+			t.Fatalf("truncated stream: got error %v, want %v", err, arithmetic.ErrTruncated)
+		}
+		if de.Offset > int64(half)*8 || de.Symbol >= int64(len(orig)) {
+			t.Errorf("truncated stream: got position %d and symbol %d", de.Offset, de.Symbol)
+		}
+
+		damaged := append([]byte(nil), enc.Bytes()...)
+		damaged[len(damaged)-1] ^= 1
+		err = arithmetic.Decode(bytes.NewReader(damaged), &bytes.Buffer{}, config.Default())
+		if !errors.Is(err, arithmetic.ErrChecksum) || !errors.As(err, &de) {
+			t.Fatalf("damaged checksum: got error %v, want %v", err, arithmetic.ErrChecksum)
+		}
+		if de.Offset != int64(len(damaged)-4)*8 || de.Symbol != int64(len(orig)) {
+			t.Errorf("damaged checksum: got position %d and symbol %d, want %d and %d",
+				de.Offset, de.Symbol, (len(damaged)-4)*8, len(orig))
+		}
+	}
+}
+
+// randomText returns size bytes of random words, which are compressible, but not too much
+func randomText(size int) []byte {
+	words := strings.Fields("the of and to in is was that for on with as by at from this which or be are")
+	rnd := rand.New(rand.NewSource(1))
+	text := &bytes.Buffer{}
+	for text.Len() < size {
+		text.WriteString(words[rnd.Intn(len(words))] + " ")
+	}
+	return text.Bytes()[:size]
+}
+
+// TestCorrupt flips bits of coded data, and checks that it is reported as corrupted rather than truncated.
+func TestCorrupt(t *testing.T) {
+	orig := randomText(4000)
+
+	blocks := config.Default()
+	blocks.BlockSize = 2048
+	for _, kind := range []config.ModelKind{config.ModelAdaptive, config.ModelPPM, config.ModelBinary, config.ModelStatic} {
+		for _, opts := range []config.Options{config.Default(), blocks} {
+			opts.ModelKind = kind
+			enc := &bytes.Buffer{}
+			if err := arithmetic.Encode(bytes.NewReader(orig), enc, opts); err != nil {
+				t.Fatalf("%v: got error while encoding: %v\n", kind, err)
+			}
+			info, err := arithmetic.ReadInfo(bytes.NewReader(enc.Bytes()))
+			if err != nil {
+				t.Fatalf("%v: got error while reading header: %v\n", kind, err)
+			}
+
+			// Bit flipped in padding of the last byte may go unnoticed, and flipped in stored data gives ErrChecksum.
+			// Sizes in block frames are not coded, so they may be flipped to claim more data than there is.
+			corrupt, flips := 0, 0
+			for i := int(info.Length); i < enc.Len()-4; i += 7 {
+				flips++
+				damaged := append([]byte(nil), enc.Bytes()...)
+				damaged[i] ^= 1 << (i % 8)
+				err := arithmetic.Decode(bytes.NewReader(damaged), io.Discard, config.Default())
+				switch {
+				case errors.Is(err, arithmetic.ErrCorrupt):
+					corrupt++
+				case errors.Is(err, arithmetic.ErrTruncated) && opts.BlockSize != 0:
+				case err != nil && !errors.Is(err, arithmetic.ErrChecksum):
+					t.Fatalf("%v, block size %d: bit flipped at byte %d: got error %v, want %v",
+						kind, opts.BlockSize, i, err, arithmetic.ErrCorrupt)
+				}
+			}
+			if opts.BlockSize == 0 && corrupt < flips*9/10 {
+				t.Errorf("%v: %d of %d bit flips are reported as %v", kind, corrupt, flips, arithmetic.ErrCorrupt)
+			}
+		}
+	}
+}
+
+// countsCoder codes table of counts the way static model does, and then every symbol as 0 out of total 2,
+// so stream of static model with counts, which its encoder never gives, can be crafted.
+type countsCoder struct {
+	counts []uint64
+	coded  bool
+}
+
+func (c *countsCoder) EncodeSymbol(e model.Encoder, symbol int) error {
+	if c.coded {
+		return e.Encode(0, 1, 2)
+	}
+	c.coded = true
+
+	isZero, length, mantissa := model.NewProbs(2), model.NewProbs(64), model.NewProbs(64)
+	prevZero := 0
+	for i := 0; i < table.ABCSize; i++ {
+		var count uint64
+		if i < len(c.counts) {
+			count = c.counts[i]
+		}
+		zero := 0
+		if count == 0 {
+			zero = 1
+		}
+		if err := e.EncodeBit(&isZero[prevZero], zero); err != nil {
+			return err
+		}
+		prevZero = zero
+		if zero == 1 {
+			continue
+		}
+
+		n := bits.Len64(count)
+		for j := 0; j < n; j++ {
+			bit := 1
+			if j == n-1 {
+				bit = 0
+			}
+			if err := e.EncodeBit(&length[j], bit); err != nil {
+				return err
+			}
+		}
+		for j := n - 2; j >= 0; j-- {
+			if err := e.EncodeBit(&mantissa[j], int(count>>j)&1); err != nil {
+				return err
+			}
+		}
+	}
+	return e.Encode(0, 1, 2)
+}
+
+func (c *countsCoder) DecodeSymbol(d model.Decoder) (int, error) {
+	return 0, errors.New("counts coder doesn't decode")
+}
+
+// TestStaticCounts checks that counts of static model larger than total it may have are reported as corrupted.
+func TestStaticCounts(t *testing.T) {
+	many := make([]uint64, table.ABCSize)
+	for i := range many {
+		many[i] = 1 << 15
+	}
+
+	tests := []struct {
+		name   string
+		counts []uint64
+		want   error
+	}{
+		{"valid", []uint64{1, 1}, nil},
+		{"large count", []uint64{1 << 40}, arithmetic.ErrCorrupt},
+		{"large sum", many, arithmetic.ErrCorrupt},
+		{"wrapped sum", []uint64{1 << 62, 1 << 62, 1 << 62, 1 << 62, 1}, arithmetic.ErrCorrupt},
+	}
+
+	// Data is coded with 1 bit per byte, so it isn't stored as is
+	orig := make([]byte, 100000)
+	for _, tt := range tests {
+		opts := config.Default()
+		opts.Coder = func(symbols int) model.Coder {
+			return &countsCoder{counts: tt.counts}
+		}
+		enc := &bytes.Buffer{}
+		if err := arithmetic.Encode(bytes.NewReader(orig), enc, opts); err != nil {
+			t.Fatalf("%s: got error while encoding: %v\n", tt.name, err)
+		}
+		// Stream is decoded with static model instead of custom one
+		enc.Bytes()[6] = byte(config.ModelStatic)
+
+		dec := &bytes.Buffer{}
+		err := arithmetic.Decode(enc, dec, config.Default())
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+		if err == nil && !bytes.Equal(orig, dec.Bytes()) {
+			t.Errorf("%s: original and decoded data are not equal", tt.name)
+		}
+	}
+}
+
+// TestLimit checks that decoding stops when output exceeds limits.
+func TestLimit(t *testing.T) {
+	orig := make([]byte, 4<<20)
+
+	static := config.Default()
+	static.ModelKind = config.ModelStatic
+	blocks := static
+	blocks.BlockSize = 1 << 20
+	seekable := blocks
+	seekable.Seekable = true
+
+	for _, opts := range []config.Options{static, blocks, seekable} {
+		enc := &bytes.Buffer{}
+		w := arithmetic.NewWriter(enc, int64(len(orig)), opts)
+		if _, err := w.Write(orig); err != nil {
+			t.Fatalf("%+v: got error while encoding: %v\n", opts, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%+v: got error while encoding: %v\n", opts, err)
+		}
+
+		tests := []struct {
+			maxOutput uint64
+			maxRatio  uint64
+			want      error
+		}{
+			{0, 0, nil},
+			{uint64(len(orig)), uint64(len(orig)), nil},
+			{uint64(len(orig)) - 1, 0, arithmetic.ErrLimit},
+			{0, 1000, arithmetic.ErrLimit},
+		}
+		for _, tt := range tests {
+			limited := config.Default()
+			limited.MaxOutput, limited.MaxRatio = tt.maxOutput, tt.maxRatio
+
+			dec := &bytes.Buffer{}
+			err := arithmetic.Decode(bytes.NewReader(enc.Bytes()), dec, limited)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("%+v: limits %d and %d: got error %v, want %v", opts, tt.maxOutput, tt.maxRatio, err, tt.want)
+			}
+			if err == nil && !bytes.Equal(orig, dec.Bytes()) {
+				t.Errorf("%+v: original and decoded data are not equal", opts)
+			}
+			if uint64(dec.Len()) > tt.maxOutput && tt.maxOutput != 0 {
+				t.Errorf("%+v: %d bytes are decoded over limit %d", opts, dec.Len(), tt.maxOutput)
+			}
+
+			if opts.Seekable {
+				_, err := arithmetic.NewSeekableReader(bytes.NewReader(enc.Bytes()), int64(enc.Len()), limited)
+				if !errors.Is(err, tt.want) {
+					t.Errorf("seekable: limits %d and %d: got error %v, want %v", tt.maxOutput, tt.maxRatio, err, tt.want)
+				}
+			}
+		}
+	}
+
+	// Block coded much smaller than data before it is limited by its own length, not only by total one
+	mixed := make([]byte, 4<<20)
+	rand.New(rand.NewSource(3)).Read(mixed[:2<<20])
+	seekable.BlockSize = 2 << 20
+	enc := &bytes.Buffer{}
+	if err := arithmetic.Encode(bytes.NewReader(mixed), enc, seekable); err != nil {
+		t.Fatalf("got error while encoding: %v\n", err)
+	}
+	limited := config.Default()
+	limited.MaxRatio = 2
+	if err := arithmetic.Decode(bytes.NewReader(enc.Bytes()), io.Discard, limited); !errors.Is(err, arithmetic.ErrLimit) {
+		t.Errorf("block: got error %v, want %v", err, arithmetic.ErrLimit)
+	}
+	if _, err := arithmetic.NewSeekableReader(bytes.NewReader(enc.Bytes()), int64(enc.Len()), limited); !errors.Is(err, arithmetic.ErrLimit) {
+		t.Errorf("seekable block: got error %v, want %v", err, arithmetic.ErrLimit)
+	}
+}
+
+// indexEntry is entry of index of seekable stream
+type indexEntry struct {
+	offset, size, length uint64
+	crc                  [4]byte
+}
+
+// TestIndex checks that seekable stream is rejected, if its index doesn't describe blocks following one another.
+func TestIndex(t *testing.T) {
+	opts := config.Default()
+	opts.BlockSize = 1000
+	opts.Seekable = true
+	enc := &bytes.Buffer{}
+	if err := arithmetic.Encode(bytes.NewReader(randomText(5000)), enc, opts); err != nil {
+		t.Fatalf("got error while encoding: %v\n", err)
+	}
+
+	// Index is followed by its length and by checksum of data
+	stream := enc.Bytes()
+	trailer := stream[len(stream)-8:]
+	start := len(stream) - 8 - int(binary.BigEndian.Uint32(trailer))
+	r := bytes.NewReader(stream[start : len(stream)-8])
+	count, _ := binary.ReadUvarint(r)
+	index := make([]indexEntry, count)
+	for i := range index {
+		index[i].offset, _ = binary.ReadUvarint(r)
+		index[i].size, _ = binary.ReadUvarint(r)
+		index[i].length, _ = binary.ReadUvarint(r)
+		io.ReadFull(r, index[i].crc[:])
+	}
+
+	tests := []struct {
+		name   string
+		change func(index []indexEntry) []indexEntry
+		want   error
+	}{
+		{"unchanged", func(index []indexEntry) []indexEntry { return index }, nil},
+		{"gap", func(index []indexEntry) []indexEntry { index[1].offset++; return index }, arithmetic.ErrCorrupt},
+		{"overlap", func(index []indexEntry) []indexEntry { index[2].offset--; return index }, arithmetic.ErrCorrupt},
+		{"overflow", func(index []indexEntry) []indexEntry {
+			index[1].offset, index[1].length = math.MaxUint64-5, 10
+			return index
+		}, arithmetic.ErrCorrupt},
+		{"missing block", func(index []indexEntry) []indexEntry { return index[:len(index)-1] }, arithmetic.ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		changed := tt.change(append([]indexEntry(nil), index...))
+		buf := bytes.NewBuffer(append([]byte(nil), stream[:start]...))
+		varint := make([]byte, binary.MaxVarintLen64)
+		buf.Write(varint[:binary.PutUvarint(varint, uint64(len(changed)))])
+		for _, e := range changed {
+			buf.Write(varint[:binary.PutUvarint(varint, e.offset)])
+			buf.Write(varint[:binary.PutUvarint(varint, e.size)])
+			buf.Write(varint[:binary.PutUvarint(varint, e.length)])
+			buf.Write(e.crc[:])
+		}
+		binary.Write(buf, binary.BigEndian, uint32(buf.Len()-start))
+		buf.Write(trailer[4:])
+
+		_, err := arithmetic.NewSeekableReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), config.Default())
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestInfo checks that ReadInfo describes stream as it was encoded.
+func TestInfo(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/repeating.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	blocks := config.Default()
+	blocks.ModelKind = config.ModelPPM
+	blocks.BlockSize = 500
+	blocks.Seekable = true
+
+	tests := []struct {
+		opts config.Options
+		data []byte
+		size int64
+	}{
+		{config.Default(), orig, int64(len(orig))},
+		{config.Default(), make([]byte, 100), 100},
+		{blocks, orig, -1},
+	}
+
+	for _, tt := range tests {
+		enc := &bytes.Buffer{}
+		if err := arithmetic.Encode(bytes.NewReader(tt.data), enc, tt.opts); err != nil {
+			t.Fatalf("%+v: got error while encoding: %v\n", tt.opts, err)
+		}
+
+		info, err := arithmetic.ReadInfo(bytes.NewReader(enc.Bytes()))
+		if err != nil {
+			t.Fatalf("%+v: got error while reading info: %v\n", tt.opts, err)
+		}
+		o := info.Options
+		if o.ModelKind != tt.opts.ModelKind || o.IntervalBitsUsed != tt.opts.IntervalBitsUsed || o.UpdateRangesRate != tt.opts.UpdateRangesRate ||
+			o.BlockSize != tt.opts.BlockSize || o.Seekable != tt.opts.Seekable {
+			t.Errorf("%+v: got options %+v", tt.opts, o)
+		}
+		if info.Size != tt.size || !info.Checksum || info.Custom {
+			t.Errorf("%+v: got info %+v", tt.opts, info)
+		}
+	}
+}
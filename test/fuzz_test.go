@@ -0,0 +1,117 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/cravtos/arithmetic/internal/pkg/arithmetic"
+	"github.com/cravtos/arithmetic/internal/pkg/config"
+)
+
+// maxFuzzOutput and maxFuzzRatio limit data decoded from one fuzz input.
+// The first MiB of output isn't limited by ratio.
+const (
+	maxFuzzOutput = 2 << 20
+	maxFuzzRatio  = 16
+)
+
+// fuzzOptions returns coder parameters selected by fuzzer
+func fuzzOptions(model uint8, blockSize uint16) config.Options {
+	opts := config.Default()
+	opts.ModelKind = config.ModelKind(model % uint8(config.ModelStatic+1))
+	opts.BlockSize = uint64(blockSize)
+	opts.Seekable = blockSize%2 == 1
+	return opts
+}
+
+// FuzzDecode checks that decoding arbitrary data neither panics nor hangs, and that output doesn't exceed limits.
+// Seed corpus holds short stored streams, and coded streams of every model and format,
+// which data is large and redundant enough not to be stored as is.
+func FuzzDecode(f *testing.F) {
+	for _, seed := range []string{"", "a", "abracadabra"} {
+		enc := &bytes.Buffer{}
+		if err := arithmetic.Encode(bytes.NewReader([]byte(seed)), enc, config.Default()); err != nil {
+			f.Fatalf("got error while encoding: %v\n", err)
+		}
+		f.Add(enc.Bytes())
+	}
+
+	text := randomText(10000)
+	for model := uint8(0); model <= uint8(config.ModelStatic); model++ {
+		for _, blockSize := range []uint16{0, 4096, 4097} {
+			opts := fuzzOptions(model, blockSize)
+			// Stream of unknown size is terminated by EOF symbol
+			for _, in := range []io.Reader{bytes.NewReader(text), io.MultiReader(bytes.NewReader(text))} {
+				enc := &bytes.Buffer{}
+				if err := arithmetic.Encode(in, enc, opts); err != nil {
+					f.Fatalf("%+v: got error while encoding: %v\n", opts, err)
+				}
+				if enc.Len() >= len(text)*3/4 {
+					f.Fatalf("%+v: seed is not coded", opts)
+				}
+				f.Add(enc.Bytes())
+			}
+		}
+	}
+
+	limits := config.Default()
+	limits.MaxOutput, limits.MaxRatio = maxFuzzOutput, maxFuzzRatio
+
+	// Redundant data larger than limits has to be stopped by them
+	bomb := &bytes.Buffer{}
+	if err := arithmetic.Encode(bytes.NewReader(make([]byte, 2*maxFuzzOutput)), bomb, config.Default()); err != nil {
+		f.Fatalf("got error while encoding: %v\n", err)
+	}
+	if err := arithmetic.Decode(bytes.NewReader(bomb.Bytes()), io.Discard, limits); !errors.Is(err, arithmetic.ErrLimit) {
+		f.Fatalf("got error %v, want %v", err, arithmetic.ErrLimit)
+	}
+	f.Add(bomb.Bytes())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		max := int64(len(data))*maxFuzzRatio + 1<<20
+		if max > maxFuzzOutput {
+			max = maxFuzzOutput
+		}
+
+		r, err := arithmetic.NewReader(bytes.NewReader(data), limits)
+		if err == nil {
+			if n, err := io.Copy(io.Discard, r); n > max {
+				t.Fatalf("%d bytes are decoded over limit %d, got error %v", n, max, err)
+			}
+		}
+
+		s, err := arithmetic.NewSeekableReader(bytes.NewReader(data), int64(len(data)), limits)
+		if err == nil {
+			if n, err := io.Copy(io.Discard, s); n > max {
+				t.Fatalf("seekable: %d bytes are decoded over limit %d, got error %v", n, max, err)
+			}
+		}
+	})
+}
+
+// FuzzRoundTrip checks that data is decoded back unchanged with every model and format.
+// Seed corpus in testdata/fuzz/FuzzRoundTrip covers empty data, a single byte, data ending at block boundary,
+// and every byte value.
+func FuzzRoundTrip(f *testing.F) {
+	f.Add([]byte("abracadabra"), uint8(config.ModelAdaptive), uint16(0))
+	f.Add([]byte("abracadabra"), uint8(config.ModelPPM), uint16(4))
+
+	f.Fuzz(func(t *testing.T, data []byte, model uint8, blockSize uint16) {
+		opts := fuzzOptions(model, blockSize)
+
+		enc := &bytes.Buffer{}
+		if err := arithmetic.Encode(bytes.NewReader(data), enc, opts); err != nil {
+			t.Fatalf("%+v: got error while encoding: %v\n", opts, err)
+		}
+
+		dec := &bytes.Buffer{}
+		if err := arithmetic.Decode(bytes.NewReader(enc.Bytes()), dec, config.Default()); err != nil {
+			t.Fatalf("%+v: got error while decoding: %v\n", opts, err)
+		}
+		if !bytes.Equal(data, dec.Bytes()) {
+			t.Fatalf("%+v: original and decoded data are not equal", opts)
+		}
+	})
+}
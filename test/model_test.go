@@ -0,0 +1,143 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cravtos/arithmetic/pkg/arithmetic"
+)
+
+// lowercaseModel gives lowercase letters 16 times more frequency than other symbols, and never learns.
+type lowercaseModel struct {
+	symbols int
+}
+
+func (m lowercaseModel) freq(symbol int) uint64 {
+	if symbol >= 'a' && symbol <= 'z' {
+		return 16
+	}
+	return 1
+}
+
+func (m lowercaseModel) Interval(symbol int) (low, high, total uint64) {
+	for i := 0; i < symbol; i++ {
+		low += m.freq(i)
+	}
+	return low, low + m.freq(symbol), m.Total()
+}
+
+func (m lowercaseModel) Total() uint64 {
+	return uint64(m.symbols) + 26*15
+}
+
+func (m lowercaseModel) Symbol(freq uint64) int {
+	symbol := 0
+	for freq >= m.freq(symbol) {
+		freq -= m.freq(symbol)
+		symbol++
+	}
+	return symbol
+}
+
+func (m lowercaseModel) Update(symbol int) {}
+
+// TestCustomModel compresses data with custom model, and checks that Reader needs the same model.
+func TestCustomModel(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/repeating.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+	factory := func(symbols int) arithmetic.Model {
+		return lowercaseModel{symbols: symbols}
+	}
+
+	var enc bytes.Buffer
+	w := arithmetic.NewWriter(&enc, arithmetic.WithModel(factory))
+	if _, err := w.Write(orig); err != nil {
+		t.Fatalf("got error while writing: %v\n", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("got error while closing writer: %v\n", err)
+	}
+
+	if _, err := arithmetic.NewReader(bytes.NewReader(enc.Bytes())); !errors.Is(err, arithmetic.ErrModel) {
+		t.Errorf("got error %v without model, want %v", err, arithmetic.ErrModel)
+	}
+
+	r, err := arithmetic.NewReader(&enc, arithmetic.WithModel(factory))
+	if err != nil {
+		t.Fatalf("got error while reading header: %v\n", err)
+	}
+	dec, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("got error while reading: %v\n", err)
+	}
+	if !bytes.Equal(orig, dec) {
+		t.Error("original and decoded data are not equal")
+	}
+}
+
+// bitCoder codes 9 bits of every symbol with adaptive probabilities, which depend on bit position only.
+type bitCoder struct {
+	probs [9]arithmetic.Prob
+}
+
+func newBitCoder(symbols int) arithmetic.Coder {
+	c := &bitCoder{}
+	for i := range c.probs {
+		c.probs[i] = arithmetic.ProbInit
+	}
+	return c
+}
+
+func (c *bitCoder) EncodeSymbol(e arithmetic.Encoder, symbol int) error {
+	for i := range c.probs {
+		if err := e.EncodeBit(&c.probs[i], (symbol>>i)&1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *bitCoder) DecodeSymbol(d arithmetic.Decoder) (int, error) {
+	symbol := 0
+	for i := range c.probs {
+		bit, err := d.DecodeBit(&c.probs[i])
+		if err != nil {
+			return 0, err
+		}
+		symbol |= bit << i
+	}
+	return symbol, nil
+}
+
+// TestCustomCoder compresses data with custom Coder, which uses binary coder.
+func TestCustomCoder(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/repeating.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	var enc bytes.Buffer
+	w := arithmetic.NewWriter(&enc, arithmetic.WithCoder(newBitCoder))
+	if _, err := w.Write(orig); err != nil {
+		t.Fatalf("got error while writing: %v\n", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("got error while closing writer: %v\n", err)
+	}
+
+	r, err := arithmetic.NewReader(&enc, arithmetic.WithCoder(newBitCoder))
+	if err != nil {
+		t.Fatalf("got error while reading header: %v\n", err)
+	}
+	dec, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("got error while reading: %v\n", err)
+	}
+	if !bytes.Equal(orig, dec) {
+		t.Error("original and decoded data are not equal")
+	}
+}
@@ -0,0 +1,272 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/cravtos/arithmetic/pkg/arithmetic"
+)
+
+// TestWriterReader compresses every file in test/testdata with Writer and decompresses it with Reader.
+func TestWriterReader(t *testing.T) {
+	testFiles, err := ioutil.ReadDir("./testdata")
+	if err != nil {
+		t.Fatalf("got error while getting testdata: %v\n", err)
+	}
+
+	var enc bytes.Buffer
+	w := arithmetic.NewWriter(&enc)
+	r := &arithmetic.Reader{}
+	for i, file := range testFiles {
+		if file.IsDir() {
+			continue
+		}
+		orig, err := ioutil.ReadFile("./testdata/" + file.Name())
+		if err != nil {
+			t.Fatalf("got error while reading testdata: %v\n", err)
+		}
+
+		// Reuse Writer and Reader after the first file
+		enc.Reset()
+		if i > 0 {
+			w.Reset(&enc)
+		}
+		if _, err := w.Write(orig); err != nil {
+			t.Fatalf("%s: got error while writing: %v\n", file.Name(), err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: got error while closing writer: %v\n", file.Name(), err)
+		}
+
+		if i > 0 {
+			err = r.Reset(&enc)
+		} else {
+			r, err = arithmetic.NewReader(&enc)
+		}
+		if err != nil {
+			t.Fatalf("%s: got error while reading header: %v\n", file.Name(), err)
+		}
+		dec, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: got error while reading: %v\n", file.Name(), err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatalf("%s: got error while closing reader: %v\n", file.Name(), err)
+		}
+
+		if !bytes.Equal(orig, dec) {
+			t.Errorf("%s: original and decoded data are not equal", file.Name())
+		}
+	}
+}
+
+// TestWriterSize checks that Writer with declared size rejects wrong amount of data.
+func TestWriterSize(t *testing.T) {
+	w := arithmetic.NewWriter(io.Discard, arithmetic.WithSize(2))
+	if _, err := w.Write([]byte("abc")); err == nil {
+		t.Error("writing more data than declared succeeded")
+	}
+
+	w = arithmetic.NewWriter(io.Discard, arithmetic.WithSize(2))
+	if _, err := w.Write([]byte("a")); err != nil {
+		t.Fatalf("got error while writing: %v\n", err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("writing less data than declared succeeded")
+	}
+}
+
+// TestBlocks compresses data in blocks, writing and reading it in small chunks.
+func TestBlocks(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/repeating.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	for _, size := range []int64{-1, int64(len(orig))} {
+		var enc bytes.Buffer
+		w := arithmetic.NewWriter(&enc, arithmetic.WithSize(size), arithmetic.WithBlockSize(100), arithmetic.WithWorkers(3))
+		for p := orig; len(p) > 0; {
+			n := 37
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Fatalf("size %d: got error while writing: %v\n", size, err)
+			}
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("size %d: got error while closing writer: %v\n", size, err)
+		}
+
+		r, err := arithmetic.NewReader(bytes.NewReader(enc.Bytes()), arithmetic.WithWorkers(2))
+		if err != nil {
+			t.Fatalf("size %d: got error while reading header: %v\n", size, err)
+		}
+		dec, err := ioutil.ReadAll(io.LimitReader(r, 1<<20))
+		if err != nil {
+			t.Fatalf("size %d: got error while reading: %v\n", size, err)
+		}
+		if !bytes.Equal(orig, dec) {
+			t.Errorf("size %d: original and decoded data are not equal", size)
+		}
+
+		// Stream cut in the middle of a block
+		r, err = arithmetic.NewReader(bytes.NewReader(enc.Bytes()[:enc.Len()/2]))
+		if err != nil {
+			t.Fatalf("size %d: got error while reading header: %v\n", size, err)
+		}
+		if _, err := ioutil.ReadAll(r); err == nil {
+			t.Errorf("size %d: reading truncated stream succeeded", size)
+		}
+	}
+}
+
+// TestSeekable reads ranges of seekable stream at random positions.
+func TestSeekable(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/repeating.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+
+	var enc bytes.Buffer
+	w := arithmetic.NewWriter(&enc, arithmetic.WithSeekable(100))
+	if _, err := w.Write(orig); err != nil {
+		t.Fatalf("got error while writing: %v\n", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("got error while closing writer: %v\n", err)
+	}
+
+	// Seekable stream is still readable sequentially
+	r, err := arithmetic.NewReader(bytes.NewReader(enc.Bytes()))
+	if err != nil {
+		t.Fatalf("got error while reading header: %v\n", err)
+	}
+	if dec, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(orig, dec) {
+		t.Errorf("sequential reading failed: %v", err)
+	}
+
+	// Checksum of the last block in index is followed by index length and checksum trailer
+	damaged := append([]byte(nil), enc.Bytes()...)
+	damaged[len(damaged)-9] ^= 1
+	r, err = arithmetic.NewReader(bytes.NewReader(damaged))
+	if err != nil {
+		t.Fatalf("got error while reading header: %v\n", err)
+	}
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, arithmetic.ErrChecksum) {
+		t.Errorf("sequential reading of damaged index: got error %v, want %v", err, arithmetic.ErrChecksum)
+	}
+
+	s, err := arithmetic.NewSeekableReader(bytes.NewReader(enc.Bytes()), int64(enc.Len()))
+	if err != nil {
+		t.Fatalf("got error while reading index: %v\n", err)
+	}
+	if s.Size() != int64(len(orig)) {
+		t.Fatalf("got size %d, want %d", s.Size(), len(orig))
+	}
+
+	ranges := [][2]int{{0, 10}, {95, 110}, {1000, 1000}, {250, 1300}, {len(orig) - 5, len(orig)}}
+	for _, rng := range ranges {
+		p := make([]byte, rng[1]-rng[0])
+		if _, err := s.ReadAt(p, int64(rng[0])); err != nil {
+			t.Fatalf("%v: got error while reading: %v\n", rng, err)
+		}
+		if !bytes.Equal(p, orig[rng[0]:rng[1]]) {
+			t.Errorf("%v: original and decoded data are not equal", rng)
+		}
+	}
+	if _, err := s.ReadAt(make([]byte, 10), int64(len(orig)-5)); err != io.EOF {
+		t.Errorf("reading past the end returned %v, want %v", err, io.EOF)
+	}
+
+	if _, err := s.Seek(-150, io.SeekEnd); err != nil {
+		t.Fatalf("got error while seeking: %v\n", err)
+	}
+	tail, err := ioutil.ReadAll(s)
+	if err != nil || !bytes.Equal(tail, orig[len(orig)-150:]) {
+		t.Errorf("reading after seek failed: %v", err)
+	}
+}
+
+// TestMeta checks that information about original file is read back from header.
+func TestMeta(t *testing.T) {
+	meta := arithmetic.Meta{Name: "data.txt", ModTime: time.Unix(1600000000, 5), Mode: 0640}
+
+	var enc bytes.Buffer
+	w := arithmetic.NewWriter(&enc)
+	w.SetMeta(meta)
+	if _, err := w.Write([]byte("meta")); err != nil {
+		t.Fatalf("got error while writing: %v\n", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("got error while closing writer: %v\n", err)
+	}
+
+	r, err := arithmetic.NewReader(&enc)
+	if err != nil {
+		t.Fatalf("got error while reading header: %v\n", err)
+	}
+	got := r.Meta()
+	if got.Name != meta.Name || !got.ModTime.Equal(meta.ModTime) || got.Mode != meta.Mode {
+		t.Errorf("got meta %+v, want %+v", got, meta)
+	}
+	if dec, err := ioutil.ReadAll(r); err != nil || string(dec) != "meta" {
+		t.Errorf("reading data after meta failed: %v", err)
+	}
+}
+
+// TestTimings checks that time spent in model and coder is measured, and doesn't change coded data.
+func TestTimings(t *testing.T) {
+	orig, err := ioutil.ReadFile("./testdata/repeating.txt")
+	if err != nil {
+		t.Fatalf("got error while reading testdata: %v\n", err)
+	}
+	// Blocks have to be large enough to be coded, not stored
+	orig = bytes.Repeat(orig, 4)
+
+	for _, blockSize := range []uint64{0, 4096} {
+		var plain, enc bytes.Buffer
+		for _, opts := range [][]arithmetic.Option{
+			{arithmetic.WithBlockSize(blockSize)},
+			{arithmetic.WithBlockSize(blockSize), arithmetic.WithTimings(&arithmetic.Timings{})},
+		} {
+			out := &plain
+			if len(opts) > 1 {
+				out = &enc
+			}
+			w := arithmetic.NewWriter(out, opts...)
+			if _, err := w.Write(orig); err != nil {
+				t.Fatalf("block size %d: got error while writing: %v\n", blockSize, err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("block size %d: got error while closing writer: %v\n", blockSize, err)
+			}
+		}
+		if !bytes.Equal(plain.Bytes(), enc.Bytes()) {
+			t.Errorf("block size %d: measuring changes coded data", blockSize)
+		}
+
+		timings := &arithmetic.Timings{}
+		r, err := arithmetic.NewReader(bytes.NewReader(enc.Bytes()), arithmetic.WithTimings(timings))
+		if err != nil {
+			t.Fatalf("block size %d: got error while reading header: %v\n", blockSize, err)
+		}
+		dec, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("block size %d: got error while reading: %v\n", blockSize, err)
+		}
+		if !bytes.Equal(orig, dec) {
+			t.Errorf("block size %d: original and decoded data are not equal", blockSize)
+		}
+		if timings.Modeling() <= 0 || timings.Coding() <= 0 || timings.IO() <= 0 {
+			t.Errorf("block size %d: got timings io %v, modeling %v, coding %v, want all positive",
+				blockSize, timings.IO(), timings.Modeling(), timings.Coding())
+		}
+	}
+}